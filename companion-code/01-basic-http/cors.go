@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// CORSPolicy describes which cross-origin requests are allowed.
+// PHP equivalent: one entry under nelmio_cors.paths in nelmio_cors.yaml
+type CORSPolicy struct {
+	// AllowedOrigins holds exact origins ("https://app.example.com"),
+	// wildcard patterns ("https://*.example.com") or "*" for any origin.
+	// "*" is not allowed together with AllowCredentials.
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long, in seconds, browsers may cache a preflight result.
+	MaxAge int
+}
+
+// CORSConfig holds the default policy plus per-route overrides.
+// Routes are keyed as in http.ServeMux: "/health" matches that path only,
+// "/public/" the whole subtree. The longest matching key wins.
+// PHP equivalent: nelmio_cors.defaults and nelmio_cors.paths
+type CORSConfig struct {
+	Default CORSPolicy
+	Routes  map[string]CORSPolicy
+}
+
+// LoadCORSConfig reads the default policy from the environment.
+// Lists are comma-separated, e.g. CORS_ALLOWED_ORIGINS=https://a.com,https://*.b.com
+// PHP equivalent: CORS_ALLOW_ORIGIN in .env read by NelmioCorsBundle
+func LoadCORSConfig() CORSConfig {
+	maxAge, err := strconv.Atoi(os.Getenv("CORS_MAX_AGE"))
+	if err != nil {
+		maxAge = 600
+	}
+
+	return CORSConfig{
+		Default: CORSPolicy{
+			AllowedOrigins:   envList("CORS_ALLOWED_ORIGINS", "*"),
+			AllowedMethods:   envList("CORS_ALLOWED_METHODS", "GET, POST, PUT, PATCH, DELETE"),
+			AllowedHeaders:   envList("CORS_ALLOWED_HEADERS", "Content-Type, Authorization, If-Match, If-None-Match"),
+			ExposedHeaders:   envList("CORS_EXPOSED_HEADERS", "ETag"),
+			AllowCredentials: os.Getenv("CORS_ALLOW_CREDENTIALS") == "true",
+			MaxAge:           maxAge,
+		},
+		Routes: make(map[string]CORSPolicy),
+	}
+}
+
+// Validate rejects policies that would let any site make credentialed
+// requests: with AllowCredentials, origins must be listed explicitly.
+func (c CORSConfig) Validate() error {
+	if err := c.Default.validate(); err != nil {
+		return fmt.Errorf("default CORS policy: %w", err)
+	}
+	for route, p := range c.Routes {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("CORS policy for %s: %w", route, err)
+		}
+	}
+	return nil
+}
+
+func (p CORSPolicy) validate() error {
+	if p.AllowCredentials && p.allowsAnyOrigin() {
+		return errors.New(`credentials need an explicit origin list, not "*" (set CORS_ALLOWED_ORIGINS)`)
+	}
+	return nil
+}
+
+// envList splits a comma-separated environment variable, trimming spaces.
+func envList(key, fallback string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		v = fallback
+	}
+
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// policyFor returns the policy for a request path.
+func (c CORSConfig) policyFor(urlPath string) CORSPolicy {
+	policy, best := c.Default, -1
+	for route, p := range c.Routes {
+		matches := urlPath == route || strings.HasSuffix(route, "/") && strings.HasPrefix(urlPath, route)
+		if matches && len(route) > best {
+			policy, best = p, len(route)
+		}
+	}
+	return policy
+}
+
+// allowsAnyOrigin reports whether the policy contains the "*" origin.
+func (p CORSPolicy) allowsAnyOrigin() bool {
+	return contains(p.AllowedOrigins, "*")
+}
+
+// allowsOrigin reports whether the origin matches an allowed origin or pattern.
+func (p CORSPolicy) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range p.AllowedOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" {
+			// Never reflect an arbitrary origin with credentials, even if
+			// Validate was skipped
+			if !p.AllowCredentials {
+				return true
+			}
+			continue
+		}
+		if allowed == origin {
+			return true
+		}
+		// "*" in path.Match never crosses a "/", so "https://*.example.com"
+		// matches subdomains but not "https://evil.com/.example.com"
+		if ok, _ := path.Match(allowed, origin); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsMethod reports whether the method may be used cross-origin.
+func (p CORSPolicy) allowsMethod(method string) bool {
+	return contains(p.AllowedMethods, method)
+}
+
+// allowsHeaders reports whether every requested header is allowed.
+func (p CORSPolicy) allowsHeaders(requested string) bool {
+	if contains(p.AllowedHeaders, "*") {
+		return true
+	}
+	for _, h := range strings.Split(requested, ",") {
+		if h = strings.TrimSpace(h); h != "" && !contains(p.AllowedHeaders, h) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains reports whether list holds s, ignoring case.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// corsMiddleware applies the CORS policy matching each request path.
+// Disallowed preflights are rejected with 403; disallowed simple requests
+// are passed through without CORS headers so the browser blocks the response.
+// PHP equivalent: NelmioCorsBundle's CorsListener
+func corsMiddleware(cfg CORSConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			policy := cfg.policyFor(r.URL.Path)
+			origin := r.Header.Get("Origin")
+
+			// A static "*" does not depend on the request; anything else does,
+			// so caches must key the response on Origin
+			wildcard := policy.allowsAnyOrigin() && !policy.AllowCredentials
+			if !wildcard {
+				w.Header().Add("Vary", "Origin")
+			}
+
+			preflight := r.Method == http.MethodOptions &&
+				origin != "" && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if preflight {
+				handlePreflight(w, r, policy, wildcard)
+				return
+			}
+
+			if wildcard {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else if origin != "" && policy.allowsOrigin(origin) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				if policy.AllowCredentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+
+			if w.Header().Get("Access-Control-Allow-Origin") != "" && len(policy.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// handlePreflight answers an OPTIONS preflight without calling the handler.
+func handlePreflight(w http.ResponseWriter, r *http.Request, policy CORSPolicy, wildcard bool) {
+	origin := r.Header.Get("Origin")
+	method := r.Header.Get("Access-Control-Request-Method")
+	headers := r.Header.Get("Access-Control-Request-Headers")
+
+	w.Header().Add("Vary", "Access-Control-Request-Method")
+	w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+	if !policy.allowsOrigin(origin) || !policy.allowsMethod(method) || !policy.allowsHeaders(headers) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if wildcard {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if policy.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(policy.AllowedMethods, ", "))
+	if headers != "" {
+		// Echo back what was asked for; it has been checked against the allow-list
+		w.Header().Set("Access-Control-Allow-Headers", headers)
+	}
+	if policy.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(policy.MaxAge))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
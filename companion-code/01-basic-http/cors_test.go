@@ -0,0 +1,213 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testCORSConfig returns a strict policy with a public override for /public.
+func testCORSConfig() CORSConfig {
+	return CORSConfig{
+		Default: CORSPolicy{
+			AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+			AllowedMethods:   []string{"GET", "POST"},
+			AllowedHeaders:   []string{"Content-Type"},
+			ExposedHeaders:   []string{"X-Request-ID"},
+			AllowCredentials: true,
+			MaxAge:           300,
+		},
+		Routes: map[string]CORSPolicy{
+			"/public/": {AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}},
+		},
+	}
+}
+
+// TestCORSPreflight tests preflight acceptance and rejection.
+// PHP equivalent: functional test of NelmioCorsBundle configuration
+func TestCORSPreflight(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		origin     string
+		method     string
+		headers    string
+		wantStatus int
+		wantOrigin string
+	}{
+		{
+			name:       "allowed exact origin",
+			path:       "/users",
+			origin:     "https://app.example.com",
+			method:     "POST",
+			headers:    "content-type",
+			wantStatus: http.StatusNoContent,
+			wantOrigin: "https://app.example.com",
+		},
+		{
+			name:       "allowed pattern origin",
+			path:       "/users",
+			origin:     "https://admin.example.org",
+			method:     "GET",
+			wantStatus: http.StatusNoContent,
+			wantOrigin: "https://admin.example.org",
+		},
+		{
+			name:       "disallowed origin",
+			path:       "/users",
+			origin:     "https://evil.com",
+			method:     "GET",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "disallowed method",
+			path:       "/users",
+			origin:     "https://app.example.com",
+			method:     "DELETE",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "disallowed header",
+			path:       "/users",
+			origin:     "https://app.example.com",
+			method:     "POST",
+			headers:    "X-Secret",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "route override",
+			path:       "/public/info",
+			origin:     "https://anywhere.net",
+			method:     "GET",
+			wantStatus: http.StatusNoContent,
+			wantOrigin: "*",
+		},
+		{
+			name:       "override does not match a longer path",
+			path:       "/publicity",
+			origin:     "https://anywhere.net",
+			method:     "GET",
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := corsMiddleware(testCORSConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Error("Handler should not be called for preflight")
+			}))
+
+			req := httptest.NewRequest("OPTIONS", tt.path, nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Expected Allow-Origin %q, got %q", tt.wantOrigin, got)
+			}
+		})
+	}
+}
+
+// TestCORSActualRequest tests headers on a non-preflight request.
+func TestCORSActualRequest(t *testing.T) {
+	called := false
+	handler := corsMiddleware(testCORSConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if !called {
+		t.Error("Expected handler to be called")
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Expected origin to be reflected, got %q", got)
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Error("Expected credentials to be allowed")
+	}
+	if w.Header().Get("Access-Control-Expose-Headers") != "X-Request-ID" {
+		t.Error("Expected exposed headers to be set")
+	}
+	if w.Header().Get("Vary") != "Origin" {
+		t.Errorf("Expected Vary: Origin, got %q", w.Header().Get("Vary"))
+	}
+}
+
+// TestCORSDisallowedOrigin tests that a disallowed origin gets no CORS headers.
+func TestCORSDisallowedOrigin(t *testing.T) {
+	handler := corsMiddleware(testCORSConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected no Allow-Origin header, got %q", got)
+	}
+}
+
+// TestLoadCORSConfig tests reading the policy from the environment.
+func TestLoadCORSConfig(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.com, https://*.b.com")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	t.Setenv("CORS_MAX_AGE", "120")
+
+	cfg := LoadCORSConfig()
+
+	if len(cfg.Default.AllowedOrigins) != 2 || cfg.Default.AllowedOrigins[1] != "https://*.b.com" {
+		t.Errorf("Unexpected origins: %v", cfg.Default.AllowedOrigins)
+	}
+	if !cfg.Default.AllowCredentials {
+		t.Error("Expected credentials to be enabled")
+	}
+	if cfg.Default.MaxAge != 120 {
+		t.Errorf("Expected max age 120, got %d", cfg.Default.MaxAge)
+	}
+}
+
+// TestCORSCredentialsNeedExplicitOrigins tests that "*" is never combined
+// with Access-Control-Allow-Credentials.
+func TestCORSCredentialsNeedExplicitOrigins(t *testing.T) {
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "")
+	if err := LoadCORSConfig().Validate(); err == nil {
+		t.Error("Expected credentials with the default \"*\" origin to be rejected")
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com")
+	if err := LoadCORSConfig().Validate(); err != nil {
+		t.Errorf("Unexpected error for an explicit origin: %v", err)
+	}
+
+	// Even unvalidated, the middleware does not reflect arbitrary origins
+	cfg := CORSConfig{Default: CORSPolicy{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}, AllowCredentials: true}}
+	handler := corsMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Origin", "https://evil.example.net")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected no Allow-Origin, got %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Expected no Allow-Credentials, got %q", got)
+	}
+}
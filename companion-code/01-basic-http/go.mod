@@ -1,3 +1,8 @@
 module github.com/Dr-H-PhD/recompiling-your-mind-code/01-basic-http
 
 go 1.22
+
+require github.com/Dr-H-PhD/recompiling-your-mind-code/internal v0.0.0
+
+// The helpers shared by every example live in ../internal
+replace github.com/Dr-H-PhD/recompiling-your-mind-code/internal => ../internal
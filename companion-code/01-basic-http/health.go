@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/httpx"
+)
+
+// healthState is where the server is in its lifecycle.
+type healthState int32
+
+const (
+	stateStarting healthState = iota
+	stateReady
+	stateShuttingDown
+)
+
+// String is the status the probes report for the state.
+func (s healthState) String() string {
+	switch s {
+	case stateReady:
+		return "ready"
+	case stateShuttingDown:
+		return "shutting down"
+	}
+	return "starting"
+}
+
+// HealthCheck reports whether a dependency is usable; nil means healthy.
+// PHP equivalent: a LiipMonitorBundle check's check() method
+type HealthCheck func(ctx context.Context) error
+
+// Health tracks liveness, readiness and dependency checks.
+// Liveness answers "should the orchestrator restart me?" and only fails if the
+// process is wedged. Readiness answers "should I get traffic?" and fails while
+// starting, while shutting down, or when a dependency check fails.
+// PHP: No equivalent - PHP-FPM workers are never "half started"
+type Health struct {
+	state        atomic.Int32 // A healthState
+	checkTimeout time.Duration
+
+	mu     sync.RWMutex
+	checks map[string]HealthCheck
+}
+
+// NewHealth creates a Health that is starting until MarkReady is called.
+func NewHealth() *Health {
+	return &Health{
+		checkTimeout: 2 * time.Second,
+		checks:       make(map[string]HealthCheck),
+	}
+}
+
+// AddCheck registers a named dependency check run by the readiness probe.
+// PHP equivalent: tagging a service with liip_monitor.check
+func (h *Health) AddCheck(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// MarkReady makes the readiness probe pass once the server is accepting connections.
+func (h *Health) MarkReady() {
+	h.state.Store(int32(stateReady))
+}
+
+// MarkShuttingDown makes the readiness probe fail for good when shutdown begins.
+func (h *Health) MarkShuttingDown() {
+	h.state.Store(int32(stateShuttingDown))
+}
+
+func (h *Health) currentState() healthState {
+	return healthState(h.state.Load())
+}
+
+// LivezHandler reports that the process is up and serving HTTP.
+func (h *Health) LivezHandler(w http.ResponseWriter, r *http.Request) {
+	httpx.Render(w, r, http.StatusOK, map[string]string{"status": "alive"})
+}
+
+// ReadyzHandler runs every check concurrently and returns 503 if the server
+// is not ready or any check fails.
+func (h *Health) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	results := h.runChecks(r.Context())
+
+	status, code := "ready", http.StatusOK
+	if state := h.currentState(); state != stateReady {
+		status, code = state.String(), http.StatusServiceUnavailable
+	}
+	for _, result := range results {
+		if result != "ok" && code == http.StatusOK {
+			status, code = "unhealthy", http.StatusServiceUnavailable
+		}
+	}
+
+	httpx.Render(w, r, code, struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks,omitempty"`
+	}{Status: status, Checks: results})
+}
+
+// HealthHandler serves the legacy /health endpoint from the readiness
+// state, so existing monitors see starts and shutdowns. It runs no
+// dependency checks.
+//
+// Deprecated: monitor /livez and /readyz instead.
+// PHP equivalent: Symfony's HealthCheck bundle
+func (h *Health) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	if state := h.currentState(); state != stateReady {
+		httpx.Render(w, r, http.StatusServiceUnavailable, map[string]string{"status": state.String()})
+		return
+	}
+	httpx.Render(w, r, http.StatusOK, map[string]string{"status": "healthy"})
+}
+
+// runChecks executes all checks in parallel, each bounded by checkTimeout.
+// A check that ignores its context is abandoned rather than waited on.
+func (h *Health) runChecks(ctx context.Context) map[string]string {
+	h.mu.RLock()
+	checks := make(map[string]HealthCheck, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.mu.RUnlock()
+
+	results := make(map[string]string, len(checks))
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, h.checkTimeout)
+			defer cancel()
+
+			done := make(chan error, 1)
+			go func() { done <- check(ctx) }()
+
+			var err error
+			select {
+			case err = <-done:
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+
+			result := "ok"
+			if err != nil {
+				result = err.Error()
+			}
+
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, check)
+	}
+
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestReadyzHandler tests readiness with the ready flag and dependency checks.
+// PHP equivalent: LiipMonitorBundle check tests
+func TestReadyzHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		state      healthState
+		check      HealthCheck
+		wantStatus int
+		wantBody   string
+	}{
+		{"ready, no checks", stateReady, nil, http.StatusOK, "ready"},
+		{"starting", stateStarting, nil, http.StatusServiceUnavailable, "starting"},
+		{"shutting down", stateShuttingDown, nil, http.StatusServiceUnavailable, "shutting down"},
+		{"passing check", stateReady, func(ctx context.Context) error { return nil }, http.StatusOK, "ready"},
+		{"failing check", stateReady, func(ctx context.Context) error { return errors.New("connection refused") }, http.StatusServiceUnavailable, "unhealthy"},
+		{"slow check", stateReady, func(ctx context.Context) error { time.Sleep(time.Second); return nil }, http.StatusServiceUnavailable, "unhealthy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealth()
+			h.checkTimeout = 50 * time.Millisecond
+			h.state.Store(int32(tt.state))
+			if tt.check != nil {
+				h.AddCheck("database", tt.check)
+			}
+
+			w := httptest.NewRecorder()
+			h.ReadyzHandler(w, httptest.NewRequest("GET", "/readyz", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+
+			var resp struct {
+				Status string            `json:"status"`
+				Checks map[string]string `json:"checks"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Status != tt.wantBody {
+				t.Errorf("Expected status %q, got %q", tt.wantBody, resp.Status)
+			}
+		})
+	}
+}
+
+// TestLivezHandler tests that liveness ignores readiness.
+func TestLivezHandler(t *testing.T) {
+	h := NewHealth()
+	h.MarkShuttingDown()
+
+	w := httptest.NewRecorder()
+	h.LivezHandler(w, httptest.NewRequest("GET", "/livez", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+}
+
+// TestServeGracefulShutdown tests that readiness fails during the drain delay
+// and that an in-flight request still completes.
+func TestServeGracefulShutdown(t *testing.T) {
+	h := NewHealth()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /readyz", h.ReadyzHandler)
+	mux.HandleFunc("GET /slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	base := "http://" + ln.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, &http.Server{Handler: mux}, ln, h, 200*time.Millisecond)
+	}()
+
+	waitForStatus(t, base+"/readyz", http.StatusOK)
+
+	// Start a slow request, then ask the server to stop
+	slow := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(base + "/slow")
+		if err != nil {
+			slow <- 0
+			return
+		}
+		resp.Body.Close()
+		slow <- resp.StatusCode
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	waitForStatus(t, base+"/readyz", http.StatusServiceUnavailable)
+
+	if status := <-slow; status != http.StatusOK {
+		t.Errorf("Expected in-flight request to complete with 200, got %d", status)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not shut down")
+	}
+}
+
+// waitForStatus polls url until it returns the wanted status or a second passes.
+func waitForStatus(t *testing.T, url string, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == want {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s never returned %d", url, want)
+}
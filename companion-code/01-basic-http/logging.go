@@ -0,0 +1,140 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/httpx"
+)
+
+// responseRecorder wraps http.ResponseWriter to capture what the handler sent.
+// PHP equivalent: reading $response->getStatusCode() in a kernel.response listener -
+// Go writes straight to the socket, so we intercept the writes instead.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK // Implicit 200 on first write
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer (Flush, deadlines).
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// AccessLogConfig controls the access log middleware.
+// PHP equivalent: Monolog channel + handler configuration in monolog.yaml
+type AccessLogConfig struct {
+	Logger *slog.Logger
+	// SampledPaths maps a path to N so only every Nth request is logged.
+	// N = 0 silences the path. Server errors are always logged.
+	SampledPaths map[string]uint64
+}
+
+// LoadAccessLogConfig builds the config from the environment.
+// ACCESS_LOG_HEALTH_SAMPLE sets N for the health and probe endpoints (default 10).
+func LoadAccessLogConfig(logger *slog.Logger) AccessLogConfig {
+	rate, err := strconv.ParseUint(os.Getenv("ACCESS_LOG_HEALTH_SAMPLE"), 10, 64)
+	if err != nil {
+		rate = 10
+	}
+
+	return AccessLogConfig{
+		Logger:       logger,
+		SampledPaths: map[string]uint64{"/health": rate, "/livez": rate, "/readyz": rate},
+	}
+}
+
+// loggingMiddleware emits one structured JSON record per request.
+// PHP equivalent: Symfony's EventListener on kernel.request/kernel.response
+// writing to Monolog with a JsonFormatter
+func loggingMiddleware(cfg AccessLogConfig) func(http.Handler) http.Handler {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	// One counter per sampled path, created up front so no locking is needed
+	counters := make(map[string]*atomic.Uint64, len(cfg.SampledPaths))
+	for p := range cfg.SampledPaths {
+		counters[p] = new(atomic.Uint64)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			// The inbound ID ends up in logs and responses, so only a
+			// well-formed one is kept; anything else gets a fresh ID
+			requestID := r.Header.Get("X-Request-ID")
+			if !httpx.ValidRequestID(requestID) {
+				requestID = httpx.NewRequestID()
+			}
+			w.Header().Set("X-Request-ID", requestID)
+			r = r.WithContext(httpx.WithRequestID(r.Context(), requestID))
+
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			if rec.status == 0 {
+				rec.status = http.StatusOK // Handler wrote nothing at all
+			}
+
+			if n, ok := cfg.SampledPaths[r.URL.Path]; ok && rec.status < 500 {
+				count := counters[r.URL.Path].Add(1)
+				if n == 0 || (count-1)%n != 0 {
+					return
+				}
+			}
+
+			level := slog.LevelInfo
+			switch {
+			case rec.status >= 500:
+				level = slog.LevelError
+			case rec.status >= 400:
+				level = slog.LevelWarn
+			}
+
+			logger.LogAttrs(r.Context(), level, "request",
+				slog.String("request_id", requestID),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rec.status),
+				slog.Int("bytes", rec.bytes),
+				slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.String("remote_ip", remoteIP(r)),
+				slog.String("user_agent", r.UserAgent()),
+			)
+		})
+	}
+}
+
+// remoteIP strips the port from RemoteAddr.
+// PHP equivalent: $request->getClientIp() (without trusted proxies)
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
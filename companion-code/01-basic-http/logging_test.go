@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/httpx"
+)
+
+// TestLoggingMiddlewareRecord tests the fields of the structured log record.
+// PHP equivalent: asserting on Monolog's TestHandler records
+func TestLoggingMiddlewareRecord(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	handler := loggingMiddleware(AccessLogConfig{Logger: logger})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}))
+
+	req := httptest.NewRequest("GET", "/brew", nil)
+	req.Header.Set("X-Request-ID", "abc123")
+	req.Header.Set("User-Agent", "test-agent")
+	req.RemoteAddr = "203.0.113.7:54321"
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected one JSON record, got %q: %v", buf.String(), err)
+	}
+
+	want := map[string]interface{}{
+		"msg":        "request",
+		"level":      "WARN",
+		"request_id": "abc123",
+		"method":     "GET",
+		"path":       "/brew",
+		"status":     float64(http.StatusTeapot),
+		"bytes":      float64(len("short and stout")),
+		"remote_ip":  "203.0.113.7",
+		"user_agent": "test-agent",
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("Expected %s = %v, got %v", key, value, record[key])
+		}
+	}
+
+	if _, ok := record["duration_ms"]; !ok {
+		t.Error("Expected duration_ms to be logged")
+	}
+	if w.Header().Get("X-Request-ID") != "abc123" {
+		t.Error("Expected request ID to be echoed on the response")
+	}
+}
+
+// TestLoggingMiddlewareGeneratesRequestID tests that a missing or malformed
+// ID is replaced before it reaches the log or the response.
+func TestLoggingMiddlewareGeneratesRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"missing", ""},
+		{"forged log line", "abc\n{\"level\":\"ERROR\"}"},
+		{"too long", strings.Repeat("a", httpx.MaxRequestIDLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			var seen string
+			handler := loggingMiddleware(AccessLogConfig{Logger: slog.New(slog.NewJSONHandler(&buf, nil))})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					seen = httpx.RequestIDFromContext(r.Context())
+				}),
+			)
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Request-ID", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			id := w.Header().Get("X-Request-ID")
+			if id == tt.header || !httpx.ValidRequestID(id) {
+				t.Errorf("Expected a fresh request ID, got %q", id)
+			}
+			if seen != id {
+				t.Errorf("Expected the handler to see %q, got %q", id, seen)
+			}
+			if strings.Contains(buf.String(), "ERROR") {
+				t.Errorf("Inbound ID reached the log: %s", buf.String())
+			}
+		})
+	}
+}
+
+// TestLoggingMiddlewareSampling tests that health checks are sampled
+// but failures are always logged.
+func TestLoggingMiddlewareSampling(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	status := http.StatusOK
+	handler := loggingMiddleware(AccessLogConfig{
+		Logger:       logger,
+		SampledPaths: map[string]uint64{"/health": 5},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	for i := 0; i < 10; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+	}
+
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Errorf("Expected 2 of 10 health checks logged, got %d", n)
+	}
+
+	buf.Reset()
+	status = http.StatusServiceUnavailable
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+
+	if !strings.Contains(buf.String(), `"status":503`) {
+		t.Errorf("Expected failing health check to be logged, got %q", buf.String())
+	}
+}
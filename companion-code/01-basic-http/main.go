@@ -3,11 +3,20 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/httpx"
 )
 
 // Response represents a JSON response structure.
@@ -20,27 +29,39 @@ type Response struct {
 // User represents a user entity.
 // PHP equivalent: App\Entity\User in Doctrine.
 type User struct {
-	ID    int    `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 func main() {
-	// Create a new ServeMux (router)
-	// PHP equivalent: Symfony's Router component
-	mux := http.NewServeMux()
+	// Structured JSON logs on stdout
+	// PHP equivalent: Monolog with JsonFormatter writing to php://stdout
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	slog.SetDefault(logger)
 
-	// Register routes
-	// PHP equivalent: routes.yaml or @Route annotations
-	mux.HandleFunc("GET /", homeHandler)
-	mux.HandleFunc("GET /health", healthHandler)
-	mux.HandleFunc("GET /users", listUsersHandler)
-	mux.HandleFunc("GET /users/{id}", getUserHandler)
-	mux.HandleFunc("POST /users", createUserHandler)
+	mux := newRouter()
+
+	// CORS policy from environment, with a per-route override
+	// PHP equivalent: nelmio_cors.yaml with a paths: section
+	cors := LoadCORSConfig()
+	cors.Routes["/health"] = CORSPolicy{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET"},
+	}
+	if err := cors.Validate(); err != nil {
+		log.Fatalf("CORS setup failed: %v", err)
+	}
 
 	// Wrap with middleware
 	// PHP equivalent: Symfony's EventListener or Middleware pattern
-	handler := loggingMiddleware(corsMiddleware(mux))
+	// Compression sits inside logging so the logged size is what went on the wire
+	handler := loggingMiddleware(LoadAccessLogConfig(logger))(
+		corsMiddleware(cors)(
+			httpx.CompressMiddleware(httpx.DefaultCompressionConfig())(mux),
+		),
+	)
 
 	// Get port from environment or default
 	// PHP equivalent: $_ENV['PORT'] or getenv('PORT')
@@ -59,13 +80,114 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	log.Printf("Server starting on port %s", port)
+	// How long readiness fails before connections are drained
+	// Gives load balancers time to take the instance out of rotation
+	drainDelay, err := time.ParseDuration(os.Getenv("SHUTDOWN_DRAIN_DELAY"))
+	if err != nil {
+		drainDelay = 5 * time.Second
+	}
+
+	// Dependency checks for /readyz go here, e.g. a database ping:
+	// health.AddCheck("database", db.PingContext)
+
+	// Cancelled on SIGINT (Ctrl+C) or SIGTERM (docker stop, Kubernetes)
+	// PHP equivalent: PHP-FPM's process manager handles signals for you
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Optional HTTPS with HTTP/2 and certificate hot reload
+	// PHP equivalent: TLS terminated by nginx in front of PHP-FPM
+	tlsSettings, err := httpx.LoadTLSSettings()
+	if err != nil {
+		log.Fatalf("TLS setup failed: %v", err)
+	}
+	if tlsSettings.Enabled() {
+		server.TLSConfig, err = tlsSettings.ServerConfig(ctx)
+		if err != nil {
+			log.Fatalf("TLS setup failed: %v", err)
+		}
+	}
+
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		log.Fatalf("Listen failed: %v", err)
+	}
+
+	log.Printf("Server starting on port %s (TLS: %t)", port, server.TLSConfig != nil)
 
-	// Start server (blocks)
+	// Start server (blocks until shutdown completes)
 	// PHP equivalent: php-fpm or built-in server
-	if err := server.ListenAndServe(); err != nil {
+	if err := serve(ctx, server, ln, health, drainDelay); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
+
+	log.Println("Server exited")
+}
+
+// shutdownTimeout bounds how long in-flight requests may take to finish.
+const shutdownTimeout = 30 * time.Second
+
+// serve runs srv on ln until ctx is cancelled, then shuts down gracefully:
+// readiness fails first, drainDelay lets load balancers stop routing to us,
+// and only then are idle connections closed and in-flight requests awaited.
+func serve(ctx context.Context, srv *http.Server, ln net.Listener, health *Health, drainDelay time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			// Certificates come from TLSConfig.GetCertificate, not files
+			errCh <- srv.ServeTLS(ln, "", "")
+			return
+		}
+		errCh <- srv.Serve(ln)
+	}()
+
+	health.MarkReady()
+
+	select {
+	case err := <-errCh:
+		return err // Serve failed before any shutdown was requested
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down: readiness now failing")
+	health.MarkShuttingDown()
+	time.Sleep(drainDelay)
+
+	log.Println("Draining connections...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// newRouter registers every route on a fresh ServeMux.
+// Kept separate from main() so tests exercise the real routing table.
+func newRouter() *http.ServeMux {
+	// Create a new ServeMux (router)
+	// PHP equivalent: Symfony's Router component
+	mux := http.NewServeMux()
+
+	// Register routes
+	// PHP equivalent: routes.yaml or @Route annotations
+	mux.HandleFunc("GET /", homeHandler)
+	mux.HandleFunc("GET /health", health.HealthHandler)
+	mux.HandleFunc("GET /livez", health.LivezHandler)
+	mux.HandleFunc("GET /readyz", health.ReadyzHandler)
+	mux.HandleFunc("GET /users", listUsersHandler)
+	mux.HandleFunc("GET /users/{id}", getUserHandler)
+	mux.HandleFunc("POST /users", createUserHandler)
+	mux.HandleFunc("PUT /users/{id}", updateUserHandler)
+	mux.HandleFunc("PATCH /users/{id}", patchUserHandler)
+	mux.HandleFunc("DELETE /users/{id}", deleteUserHandler)
+
+	return mux
 }
 
 // homeHandler handles the root route.
@@ -75,43 +197,51 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 		Message:   "Welcome to the Go HTTP server",
 		Timestamp: time.Now().Format(time.RFC3339),
 	}
-	writeJSON(w, http.StatusOK, resp)
+	httpx.Render(w, r, http.StatusOK, resp)
 }
 
-// healthHandler provides a health check endpoint.
-// PHP equivalent: Symfony's HealthCheck bundle
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
-}
+// health backs the /livez and /readyz probes, and the legacy /health.
+// PHP equivalent: LiipMonitorBundle's runner service
+var health = NewHealth()
 
 // Sample in-memory data store
 // PHP equivalent: Doctrine repository with cached entities
-var users = []User{
-	{ID: 1, Name: "Alice", Email: "alice@example.com"},
-	{ID: 2, Name: "Bob", Email: "bob@example.com"},
-}
+var users = NewUserStore(
+	User{ID: 1, Name: "Alice", Email: "alice@example.com"},
+	User{ID: 2, Name: "Bob", Email: "bob@example.com"},
+)
 
 // listUsersHandler returns all users.
+// Answers 304 Not Modified when the client's cached list is still current.
 // PHP equivalent: UserController::list() with UserRepository::findAll()
 func listUsersHandler(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusOK, users)
+	all := users.All()
+	if httpx.NotModified(w, r, httpx.ETag(all), users.LastModified()) {
+		return
+	}
+	httpx.Render(w, r, http.StatusOK, all)
 }
 
 // getUserHandler returns a single user by ID.
 // PHP equivalent: UserController::show($id) with ParamConverter
 func getUserHandler(w http.ResponseWriter, r *http.Request) {
-	// Go 1.22+ pattern matching
-	// PHP equivalent: $request->attributes->get('id')
-	id := r.PathValue("id")
+	id, ok := userID(w, r)
+	if !ok {
+		return
+	}
 
-	for _, user := range users {
-		if string(rune(user.ID+'0')) == id { // Simple conversion for demo
-			writeJSON(w, http.StatusOK, user)
-			return
-		}
+	user, err := users.Get(id)
+	if err != nil {
+		httpx.WriteProblem(w, r, http.StatusNotFound, "NOT_FOUND", "User not found")
+		return
+	}
+
+	// PHP equivalent: if ($response->isNotModified($request)) { return $response; }
+	if httpx.NotModified(w, r, httpx.ETag(user), user.UpdatedAt) {
+		return
 	}
 
-	writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+	httpx.Render(w, r, http.StatusOK, user)
 }
 
 // createUserHandler creates a new user.
@@ -119,62 +249,155 @@ func getUserHandler(w http.ResponseWriter, r *http.Request) {
 func createUserHandler(w http.ResponseWriter, r *http.Request) {
 	var user User
 
-	// Decode JSON body
+	// Decode JSON body (size-limited, unknown fields rejected)
 	// PHP equivalent: $serializer->deserialize($request->getContent(), User::class, 'json')
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	if err := httpx.DecodeJSON(w, r, &user); err != nil {
+		httpx.WriteDecodeError(w, r, err)
 		return
 	}
 
 	// Validate
 	// PHP equivalent: $validator->validate($user)
 	if user.Name == "" || user.Email == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Name and email required"})
+		httpx.WriteProblem(w, r, http.StatusBadRequest, "BAD_REQUEST", "Name and email required")
 		return
 	}
 
 	// Assign ID and save
 	// PHP equivalent: $entityManager->persist($user); $entityManager->flush();
-	user.ID = len(users) + 1
-	users = append(users, user)
+	user = users.Create(user)
 
-	writeJSON(w, http.StatusCreated, user)
+	w.Header().Set("ETag", httpx.ETag(user))
+	httpx.Render(w, r, http.StatusCreated, user)
 }
 
-// writeJSON is a helper to write JSON responses.
-// PHP equivalent: return $this->json($data, $status)
-func writeJSON(w http.ResponseWriter, status int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(data)
-}
+// updateUserHandler replaces a user.
+// PHP equivalent: UserController::update($id) with #[Route(methods: ['PUT'])]
+func updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := userID(w, r)
+	if !ok {
+		return
+	}
 
-// loggingMiddleware logs each request.
-// PHP equivalent: Symfony's EventListener on kernel.request/kernel.response
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		log.Printf("Started %s %s", r.Method, r.URL.Path)
+	var input User
+	if err := httpx.DecodeJSON(w, r, &input); err != nil {
+		httpx.WriteDecodeError(w, r, err)
+		return
+	}
 
-		next.ServeHTTP(w, r)
+	// PUT replaces the whole resource, so every field is required
+	if input.Name == "" || input.Email == "" {
+		httpx.WriteProblem(w, r, http.StatusBadRequest, "BAD_REQUEST", "Name and email required")
+		return
+	}
 
-		log.Printf("Completed %s %s in %v", r.Method, r.URL.Path, time.Since(start))
+	user, err := users.Update(id, func(u *User) error {
+		// Optimistic concurrency: reject if the client edited a stale copy
+		if err := httpx.CheckIfMatch(r, *u); err != nil {
+			return err
+		}
+		u.Name = input.Name
+		u.Email = input.Email
+		return nil
 	})
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", httpx.ETag(user))
+	httpx.Render(w, r, http.StatusOK, user)
 }
 
-// corsMiddleware adds CORS headers.
-// PHP equivalent: NelmioCorsBundle or manual headers in EventListener
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+// userPatch holds the fields a PATCH request may change.
+// Pointers distinguish "not sent" (nil) from "sent as empty" ("").
+// PHP equivalent: array_key_exists() checks on the decoded payload
+type userPatch struct {
+	Name  *string `json:"name"`
+	Email *string `json:"email"`
+}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+// patchUserHandler partially updates a user.
+// PHP equivalent: UserController::patch($id) with $form->submit($data, false)
+func patchUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := userID(w, r)
+	if !ok {
+		return
+	}
+
+	var patch userPatch
+	if err := httpx.DecodeJSON(w, r, &patch); err != nil {
+		httpx.WriteDecodeError(w, r, err)
+		return
+	}
+
+	if (patch.Name != nil && *patch.Name == "") || (patch.Email != nil && *patch.Email == "") {
+		httpx.WriteProblem(w, r, http.StatusBadRequest, "BAD_REQUEST", "Name and email cannot be empty")
+		return
+	}
+
+	user, err := users.Update(id, func(u *User) error {
+		if err := httpx.CheckIfMatch(r, *u); err != nil {
+			return err
+		}
+		if patch.Name != nil {
+			u.Name = *patch.Name
 		}
+		if patch.Email != nil {
+			u.Email = *patch.Email
+		}
+		return nil
+	})
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
 
-		next.ServeHTTP(w, r)
+	w.Header().Set("ETag", httpx.ETag(user))
+	httpx.Render(w, r, http.StatusOK, user)
+}
+
+// deleteUserHandler removes a user.
+// PHP equivalent: UserController::delete($id)
+func deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := userID(w, r)
+	if !ok {
+		return
+	}
+
+	err := users.DeleteIf(id, func(u User) error {
+		return httpx.CheckIfMatch(r, u)
 	})
+	if err != nil {
+		writeStoreError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeStoreError maps store errors to HTTP responses.
+// PHP equivalent: an ExceptionListener mapping exceptions to status codes
+func writeStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		httpx.WriteProblem(w, r, http.StatusNotFound, "NOT_FOUND", "User not found")
+	case errors.Is(err, httpx.ErrPreconditionFailed):
+		httpx.WriteProblem(w, r, http.StatusPreconditionFailed, "PRECONDITION_FAILED", "User was modified, fetch it again")
+	default:
+		httpx.WriteProblem(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "An unexpected error occurred")
+	}
+}
+
+// userID parses the {id} path parameter, writing a 400 if it is not a number.
+// PHP equivalent: requirements: ['id' => '\d+'] on the route
+func userID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	// Go 1.22+ pattern matching
+	// PHP equivalent: $request->attributes->get('id')
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		httpx.WriteProblem(w, r, http.StatusBadRequest, "BAD_REQUEST", "Invalid user ID")
+		return 0, false
+	}
+	return id, true
 }
@@ -3,9 +3,14 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/httpx"
 )
 
 // TestHomeHandler tests the home endpoint.
@@ -41,22 +46,38 @@ func TestHomeHandler(t *testing.T) {
 	}
 }
 
-// TestHealthHandler tests the health check endpoint.
+// TestHealthHandler tests that the legacy endpoint follows readiness.
 func TestHealthHandler(t *testing.T) {
-	req := httptest.NewRequest("GET", "/health", nil)
-	w := httptest.NewRecorder()
+	tests := []struct {
+		name       string
+		mark       func(h *Health)
+		wantCode   int
+		wantStatus string
+	}{
+		{"starting", func(h *Health) {}, http.StatusServiceUnavailable, "starting"},
+		{"ready", (*Health).MarkReady, http.StatusOK, "healthy"},
+		{"shutting down", (*Health).MarkShuttingDown, http.StatusServiceUnavailable, "shutting down"},
+	}
 
-	healthHandler(w, req)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealth()
+			tt.mark(h)
 
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
-	}
+			w := httptest.NewRecorder()
+			h.HealthHandler(w, httptest.NewRequest("GET", "/health", nil))
 
-	var resp map[string]string
-	json.NewDecoder(w.Body).Decode(&resp)
+			if w.Code != tt.wantCode {
+				t.Errorf("Expected status %d, got %d", tt.wantCode, w.Code)
+			}
 
-	if resp["status"] != "healthy" {
-		t.Errorf("Expected status 'healthy', got '%s'", resp["status"])
+			var resp map[string]string
+			json.NewDecoder(w.Body).Decode(&resp)
+
+			if resp["status"] != tt.wantStatus {
+				t.Errorf("Expected status %q, got %q", tt.wantStatus, resp["status"])
+			}
+		})
 	}
 }
 
@@ -130,7 +151,7 @@ func TestLoggingMiddleware(t *testing.T) {
 	})
 
 	// Wrap with middleware
-	wrapped := loggingMiddleware(handler)
+	wrapped := loggingMiddleware(AccessLogConfig{})(handler)
 
 	req := httptest.NewRequest("GET", "/test", nil)
 	w := httptest.NewRecorder()
@@ -148,7 +169,7 @@ func TestCorsMiddleware(t *testing.T) {
 		w.WriteHeader(http.StatusOK)
 	})
 
-	wrapped := corsMiddleware(handler)
+	wrapped := corsMiddleware(LoadCORSConfig())(handler)
 
 	req := httptest.NewRequest("GET", "/test", nil)
 	w := httptest.NewRecorder()
@@ -167,14 +188,413 @@ func TestCorsMiddlewarePreflight(t *testing.T) {
 		t.Error("Handler should not be called for OPTIONS")
 	})
 
-	wrapped := corsMiddleware(handler)
+	wrapped := corsMiddleware(LoadCORSConfig())(handler)
 
 	req := httptest.NewRequest("OPTIONS", "/test", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
 	w := httptest.NewRecorder()
 
 	wrapped.ServeHTTP(w, req)
 
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204 for preflight, got %d", w.Code)
+	}
+}
+
+// resetUsers replaces the global store with a fresh seeded copy.
+// PHP equivalent: reloading fixtures in setUp()
+func resetUsers(t *testing.T) {
+	t.Helper()
+	users = NewUserStore(
+		User{ID: 1, Name: "Alice", Email: "alice@example.com"},
+		User{ID: 2, Name: "Bob", Email: "bob@example.com"},
+	)
+}
+
+// TestGetUserHandler tests fetching a single user through the router.
+func TestGetUserHandler(t *testing.T) {
+	resetUsers(t)
+	router := newRouter()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{name: "existing user", path: "/users/1", wantStatus: http.StatusOK},
+		{name: "two-digit ID", path: "/users/12", wantStatus: http.StatusNotFound},
+		{name: "non-numeric ID", path: "/users/abc", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
+
+// TestUpdateUserHandler tests replacing a user with PUT.
+func TestUpdateUserHandler(t *testing.T) {
+	resetUsers(t)
+	router := newRouter()
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "valid replace",
+			path:       "/users/1",
+			body:       `{"name": "Alicia", "email": "alicia@example.com"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "missing email",
+			path:       "/users/1",
+			body:       `{"name": "Alicia"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown user",
+			path:       "/users/99",
+			body:       `{"name": "Nobody", "email": "nobody@example.com"}`,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+
+	user, _ := users.Get(1)
+	if user.Name != "Alicia" || user.Email != "alicia@example.com" {
+		t.Errorf("Expected user to be replaced, got %+v", user)
+	}
+}
+
+// TestPatchUserHandler tests that PATCH only touches the fields sent.
+func TestPatchUserHandler(t *testing.T) {
+	resetUsers(t)
+	router := newRouter()
+
+	req := httptest.NewRequest("PATCH", "/users/2", bytes.NewBufferString(`{"name": "Robert"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200 for OPTIONS, got %d", w.Code)
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var user User
+	if err := json.NewDecoder(w.Body).Decode(&user); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if user.Name != "Robert" {
+		t.Errorf("Expected name 'Robert', got '%s'", user.Name)
+	}
+	if user.Email != "bob@example.com" {
+		t.Errorf("Expected email to be unchanged, got '%s'", user.Email)
+	}
+}
+
+// TestDeleteUserHandler tests deleting a user and that its ID is never reused.
+func TestDeleteUserHandler(t *testing.T) {
+	resetUsers(t)
+	router := newRouter()
+
+	req := httptest.NewRequest("DELETE", "/users/2", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("DELETE", "/users/2", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 on second delete, got %d", w.Code)
+	}
+
+	// With len(users)+1 this would hand out ID 2 again
+	created := users.Create(User{Name: "Charlie", Email: "charlie@example.com"})
+	if created.ID != 3 {
+		t.Errorf("Expected new user to get ID 3, got %d", created.ID)
+	}
+}
+
+// TestUserHandlersConcurrent hammers the handlers from many goroutines.
+// Run with `make race` - the race detector fails the test on unsynchronised access.
+// PHP: No equivalent - each PHP-FPM request has its own memory
+func TestUserHandlersConcurrent(t *testing.T) {
+	resetUsers(t)
+	router := newRouter()
+
+	const workers = 50
+
+	var wg sync.WaitGroup
+	ids := make(chan int, workers)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			body := fmt.Sprintf(`{"name": "User %d", "email": "user%d@example.com"}`, i, i)
+			req := httptest.NewRequest("POST", "/users", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var user User
+			if err := json.NewDecoder(w.Body).Decode(&user); err != nil {
+				t.Errorf("Failed to decode response: %v", err)
+				return
+			}
+			ids <- user.ID
+
+			// Mix reads and writes on the same user
+			path := fmt.Sprintf("/users/%d", user.ID)
+			for _, method := range []string{"GET", "PATCH", "GET", "DELETE"} {
+				req := httptest.NewRequest(method, path, bytes.NewBufferString(`{"name": "Renamed"}`))
+				req.Header.Set("Content-Type", "application/json")
+				router.ServeHTTP(httptest.NewRecorder(), req)
+			}
+
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users", nil))
+		}(i)
+	}
+
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[int]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("ID %d was assigned twice", id)
+		}
+		seen[id] = true
+	}
+
+	if len(seen) != workers {
+		t.Errorf("Expected %d unique IDs, got %d", workers, len(seen))
+	}
+
+	if n := len(users.All()); n != 2 {
+		t.Errorf("Expected only the 2 seed users to remain, got %d", n)
+	}
+}
+
+// TestCompressMiddlewareListUsers tests compression end to end through the router.
+func TestCompressMiddlewareListUsers(t *testing.T) {
+	resetUsers(t)
+	for i := 0; i < 50; i++ {
+		users.Create(User{Name: "Generated User", Email: "generated@example.com"})
+	}
+
+	handler := httpx.CompressMiddleware(httpx.DefaultCompressionConfig())(newRouter())
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip, got %q", w.Header().Get("Content-Encoding"))
+	}
+	if w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected Content-Type to be preserved, got %q", w.Header().Get("Content-Type"))
+	}
+}
+
+// TestGetUserConditional tests 304 responses for If-None-Match and If-Modified-Since.
+// PHP equivalent: WebTestCase asserting $response->isNotModified()
+func TestGetUserConditional(t *testing.T) {
+	resetUsers(t)
+	router := newRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/users/1", nil))
+
+	tag := w.Header().Get("ETag")
+	lastModified := w.Header().Get("Last-Modified")
+	if tag == "" || lastModified == "" {
+		t.Fatalf("Expected ETag and Last-Modified, got %q and %q", tag, lastModified)
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		wantStatus int
+	}{
+		{"matching etag", "If-None-Match", tag, http.StatusNotModified},
+		{"weak matching etag", "If-None-Match", "W/" + tag, http.StatusNotModified},
+		{"stale etag", "If-None-Match", `"stale"`, http.StatusOK},
+		{"not modified since", "If-Modified-Since", lastModified, http.StatusNotModified},
+		{"modified since", "If-Modified-Since", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/users/1", nil)
+			req.Header.Set(tt.header, tt.value)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if w.Code == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Error("Expected an empty body on 304")
+			}
+		})
+	}
+}
+
+// TestListUsersEtagChangesOnDelete tests that deleting a user invalidates the list ETag.
+func TestListUsersEtagChangesOnDelete(t *testing.T) {
+	resetUsers(t)
+	router := newRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/users", nil))
+	tag := w.Header().Get("ETag")
+
+	users.Delete(2)
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("If-None-Match", tag)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 after a delete, got %d", w.Code)
+	}
+}
+
+// TestUpdateUserIfMatch tests optimistic concurrency with If-Match.
+func TestUpdateUserIfMatch(t *testing.T) {
+	resetUsers(t)
+	router := newRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/users/1", nil))
+	tag := w.Header().Get("ETag")
+
+	patch := func(ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/users/1", bytes.NewBufferString(`{"name": "Alicia"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", ifMatch)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// First writer wins
+	w = patch(tag)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if w.Header().Get("ETag") == tag {
+		t.Error("Expected a new ETag after the update")
+	}
+
+	// Second writer still holds the old ETag
+	if w := patch(tag); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status 412 for a stale ETag, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest("DELETE", "/users/1", nil)
+	req.Header.Set("If-Match", tag)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status 412 for a stale delete, got %d", w.Code)
+	}
+	if _, err := users.Get(1); err != nil {
+		t.Error("Expected the user to survive a failed conditional delete")
+	}
+}
+
+// TestGetUserNotFoundProblem tests an error response end to end.
+func TestGetUserNotFoundProblem(t *testing.T) {
+	resetUsers(t)
+
+	req := httptest.NewRequest("GET", "/users/99", nil)
+	w := httptest.NewRecorder()
+	handler := loggingMiddleware(AccessLogConfig{})(newRouter())
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Expected application/problem+json, got %q", ct)
+	}
+
+	var p httpx.Problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != 404 || p.Title != "Not Found" || p.Instance != "/users/99" {
+		t.Errorf("Unexpected problem %+v", p)
+	}
+	if code := p.Extensions["code"]; code != "NOT_FOUND" {
+		t.Errorf("Expected code NOT_FOUND, got %v", code)
+	}
+	if id := p.Extensions["request_id"]; id == nil || id != w.Header().Get("X-Request-ID") {
+		t.Errorf("Expected request_id %q, got %v", w.Header().Get("X-Request-ID"), id)
+	}
+}
+
+// TestCreateUserHandlerFieldError tests that the field path reaches the client.
+func TestCreateUserHandlerFieldError(t *testing.T) {
+	resetUsers(t)
+
+	req := httptest.NewRequest("POST", "/users", bytes.NewBufferString(`{"name": "Eve", "email": "eve@example.com", "role": "admin"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	createUserHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", w.Code)
+	}
+
+	var problem httpx.Problem
+	json.NewDecoder(w.Body).Decode(&problem)
+
+	errs, _ := problem.Extensions["errors"].(map[string]interface{})
+	if _, ok := errs["role"]; !ok {
+		t.Errorf("Expected an error for field 'role', got %v", problem.Extensions)
 	}
 }
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrUserNotFound is returned when no user exists for the given ID.
+// PHP equivalent: EntityNotFoundException thrown by a repository
+var ErrUserNotFound = errors.New("user not found")
+
+// UserStore is a concurrency-safe in-memory user repository.
+// PHP equivalent: Doctrine repository - but PHP-FPM never shares it between requests,
+// whereas Go handlers run concurrently and must lock shared state.
+type UserStore struct {
+	mu       sync.RWMutex
+	users    map[int]User
+	nextID   int
+	modified time.Time // Last change of any kind, including deletes
+}
+
+// NewUserStore creates a store pre-populated with the given users.
+// IDs keep increasing even after deletes, like a database sequence.
+func NewUserStore(seed ...User) *UserStore {
+	s := &UserStore{
+		users:    make(map[int]User),
+		nextID:   1,
+		modified: time.Now(),
+	}
+	for _, u := range seed {
+		if u.UpdatedAt.IsZero() {
+			u.UpdatedAt = s.modified
+		}
+		s.users[u.ID] = u
+		if u.ID >= s.nextID {
+			s.nextID = u.ID + 1
+		}
+	}
+	return s
+}
+
+// All returns every user ordered by ID.
+// PHP equivalent: $repository->findBy([], ['id' => 'ASC'])
+func (s *UserStore) All() []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
+
+// Get returns the user with the given ID.
+// PHP equivalent: $repository->find($id)
+func (s *UserStore) Get(id int) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return u, nil
+}
+
+// Create assigns the next ID to the user and stores it.
+// PHP equivalent: $em->persist($user); $em->flush();
+func (s *UserStore) Create(u User) User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u.ID = s.nextID
+	u.UpdatedAt = time.Now()
+	s.nextID++
+	s.users[u.ID] = u
+	s.modified = u.UpdatedAt
+	return u
+}
+
+// Update applies fn to a copy of the user and saves the result.
+// The lock is held for the whole read-modify-write, so concurrent
+// PATCH requests cannot overwrite each other's changes.
+// If fn returns an error the user is left untouched.
+func (s *UserStore) Update(id int, fn func(*User) error) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	if err := fn(&u); err != nil {
+		return User{}, err
+	}
+	u.ID = id // The ID is immutable
+	u.UpdatedAt = time.Now()
+	s.users[id] = u
+	s.modified = u.UpdatedAt
+	return u, nil
+}
+
+// Delete removes the user with the given ID.
+// PHP equivalent: $em->remove($user); $em->flush();
+func (s *UserStore) Delete(id int) error {
+	return s.DeleteIf(id, nil)
+}
+
+// DeleteIf removes the user only if check (when non-nil) returns nil,
+// evaluated under the same lock as the delete.
+func (s *UserStore) DeleteIf(id int, check func(User) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if check != nil {
+		if err := check(u); err != nil {
+			return err
+		}
+	}
+	delete(s.users, id)
+	s.modified = time.Now()
+	return nil
+}
+
+// LastModified returns when the collection last changed.
+// PHP equivalent: MAX(updated_at) - but that misses deletes, so we track it directly
+func (s *UserStore) LastModified() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.modified
+}
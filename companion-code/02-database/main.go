@@ -5,14 +5,23 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"time"
 
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/pgerr"
 	_ "github.com/lib/pq" // PostgreSQL driver
 )
 
+// Sentinel errors, matched with errors.Is.
+// PHP equivalent: custom exception classes such as UserNotFoundException
+var (
+	ErrNotFound = errors.New("resource not found")
+	ErrConflict = errors.New("resource already exists")
+)
+
 // User represents a user entity.
 // PHP equivalent: App\Entity\User with Doctrine annotations
 type User struct {
@@ -23,7 +32,10 @@ type User struct {
 	UpdatedAt time.Time
 }
 
-// UserRepository handles user database operations.
+// UserRepository handles user database operations. It is a standalone
+// sketch of the pattern: the REST API example's UserRepository is an
+// interface with paging, password hashes and roles, and is checked by a
+// contract test suite this one does not run.
 // PHP equivalent: App\Repository\UserRepository extends ServiceEntityRepository
 type UserRepository struct {
 	db *sql.DB
@@ -75,9 +87,9 @@ func (r *UserRepository) FindByID(ctx context.Context, id int64) (*User, error)
 		&u.ID, &u.Name, &u.Email, &u.CreatedAt, &u.UpdatedAt,
 	)
 
-	if err == sql.ErrNoRows {
-		// PHP equivalent: return null from find()
-		return nil, nil
+	if errors.Is(err, sql.ErrNoRows) {
+		// PHP equivalent: find() returns null; here the caller checks errors.Is(err, ErrNotFound)
+		return nil, fmt.Errorf("user %d: %w", id, ErrNotFound)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
@@ -86,7 +98,8 @@ func (r *UserRepository) FindByID(ctx context.Context, id int64) (*User, error)
 	return &u, nil
 }
 
-// FindByEmail retrieves a user by email.
+// FindByEmail retrieves a user by email. It matches exactly, as the UNIQUE
+// constraint in migrations/001_create_users.sql does.
 // PHP equivalent: $this->findOneBy(['email' => $email])
 func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*User, error) {
 	query := `SELECT id, name, email, created_at, updated_at FROM users WHERE email = $1`
@@ -96,8 +109,8 @@ func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*User,
 		&u.ID, &u.Name, &u.Email, &u.CreatedAt, &u.UpdatedAt,
 	)
 
-	if err == sql.ErrNoRows {
-		return nil, nil
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %s: %w", email, ErrNotFound)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
@@ -124,6 +137,9 @@ func (r *UserRepository) Create(ctx context.Context, user *User) error {
 	err := r.db.QueryRowContext(ctx, query, user.Name, user.Email, user.CreatedAt, user.UpdatedAt).
 		Scan(&user.ID)
 
+	if pgerr.IsUniqueViolation(err) {
+		return fmt.Errorf("email %s: %w", user.Email, ErrConflict)
+	}
 	if err != nil {
 		return fmt.Errorf("insert failed: %w", err)
 	}
@@ -131,53 +147,79 @@ func (r *UserRepository) Create(ctx context.Context, user *User) error {
 	return nil
 }
 
-// Update modifies an existing user.
-// PHP equivalent: $em->flush() after modifying entity
-func (r *UserRepository) Update(ctx context.Context, user *User) error {
-	query := `
-		UPDATE users
-		SET name = $1, email = $2, updated_at = $3
-		WHERE id = $4
-	`
-
-	user.UpdatedAt = time.Now()
-
-	result, err := r.db.ExecContext(ctx, query, user.Name, user.Email, user.UpdatedAt, user.ID)
-	if err != nil {
-		return fmt.Errorf("update failed: %w", err)
-	}
-
-	// Check if any row was actually updated
-	affected, err := result.RowsAffected()
+// Update applies fn to the current user and saves the result atomically.
+// If fn returns an error nothing is saved. The row stays locked from the
+// read to the write, so concurrent updates cannot overwrite each other.
+// PHP equivalent: $em->find($id, LockMode::PESSIMISTIC_WRITE), then $em->flush()
+func (r *UserRepository) Update(ctx context.Context, id int64, fn func(*User) error) (*User, error) {
+	var updated *User
+	err := r.WithTransaction(ctx, func(tx *sql.Tx) error {
+		u, err := lockUser(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := fn(u); err != nil {
+			return err
+		}
+		// ID and CreatedAt cannot change
+		u.ID = id
+		u.UpdatedAt = time.Now()
+
+		query := `
+			UPDATE users
+			SET name = $1, email = $2, updated_at = $3
+			WHERE id = $4
+		`
+		_, err = tx.ExecContext(ctx, query, u.Name, u.Email, u.UpdatedAt, id)
+		if pgerr.IsUniqueViolation(err) {
+			return fmt.Errorf("email %s: %w", u.Email, ErrConflict)
+		}
+		if err != nil {
+			return fmt.Errorf("update failed: %w", err)
+		}
+		updated = u
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("rows affected: %w", err)
-	}
-	if affected == 0 {
-		return fmt.Errorf("user not found: %d", user.ID)
+		return nil, err
 	}
-
-	return nil
+	return updated, nil
 }
 
-// Delete removes a user by ID.
+// Delete removes a user by ID if check, when non-nil, accepts it.
 // PHP equivalent: $em->remove($user); $em->flush();
-func (r *UserRepository) Delete(ctx context.Context, id int64) error {
-	query := `DELETE FROM users WHERE id = $1`
+func (r *UserRepository) Delete(ctx context.Context, id int64, check func(*User) error) error {
+	return r.WithTransaction(ctx, func(tx *sql.Tx) error {
+		u, err := lockUser(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if check != nil {
+			if err := check(u); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id); err != nil {
+			return fmt.Errorf("delete failed: %w", err)
+		}
+		return nil
+	})
+}
 
-	result, err := r.db.ExecContext(ctx, query, id)
-	if err != nil {
-		return fmt.Errorf("delete failed: %w", err)
-	}
+// lockUser reads a user and locks the row until the transaction ends.
+// PHP equivalent: LockMode::PESSIMISTIC_WRITE
+func lockUser(ctx context.Context, tx *sql.Tx, id int64) (*User, error) {
+	query := `SELECT id, name, email, created_at, updated_at FROM users WHERE id = $1 FOR UPDATE`
 
-	affected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("rows affected: %w", err)
+	var u User
+	err := tx.QueryRowContext(ctx, query, id).Scan(&u.ID, &u.Name, &u.Email, &u.CreatedAt, &u.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %d: %w", id, ErrNotFound)
 	}
-	if affected == 0 {
-		return fmt.Errorf("user not found: %d", id)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
 	}
-
-	return nil
+	return &u, nil
 }
 
 // WithTransaction executes operations within a transaction.
@@ -246,7 +288,9 @@ func main() {
 		Email: "test@example.com",
 	}
 
-	if err := repo.Create(ctx, user); err != nil {
+	if err := repo.Create(ctx, user); errors.Is(err, ErrConflict) {
+		log.Printf("User already exists: %v", err)
+	} else if err != nil {
 		log.Printf("Create user: %v", err)
 	} else {
 		log.Printf("Created user: %+v", user)
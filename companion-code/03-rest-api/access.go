@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Roles carried in the "roles" claim.
+// PHP equivalent: role_hierarchy in security.yaml
+const (
+	RoleUser  = "ROLE_USER"
+	RoleAdmin = "ROLE_ADMIN"
+)
+
+// Scopes carried in the space-separated "scope" claim.
+const (
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+)
+
+// AccessRule declares who may call a route. The zero value admits any
+// authenticated caller, so forgetting a rule never makes a route public.
+// PHP equivalent: an access_control entry, or #[IsGranted] on a controller
+type AccessRule struct {
+	// Public routes need no token at all.
+	Public bool
+	// Roles admits callers holding any one of them.
+	Roles []string
+	// Scopes must all be present in the token.
+	Scopes []string
+	// Owner names a path wildcard, e.g. "id" in /users/{id}, that must equal
+	// the token subject. Admins may act on any resource.
+	// PHP equivalent: a Voter comparing $subject->getId() with $user->getId()
+	Owner string
+}
+
+// Public and Authenticated are the two most common rules.
+var (
+	Public        = AccessRule{Public: true}
+	Authenticated = AccessRule{}
+)
+
+// Route is one entry in the API's route table.
+type Route struct {
+	Pattern string
+	Handler http.HandlerFunc
+	Access  AccessRule
+}
+
+// registerRoutes adds each route to the mux behind its access rule.
+func registerRoutes(mux *http.ServeMux, routes []Route) {
+	for _, rt := range routes {
+		mux.Handle(rt.Pattern, Authorize(rt.Access)(rt.Handler))
+	}
+}
+
+// Authorize enforces rule using the claims AuthMiddleware stored in the context.
+// Missing credentials give 401; valid credentials without permission give 403.
+// PHP equivalent: AccessListener + AccessDecisionManager
+func Authorize(rule AccessRule) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rule.Public {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Missing or invalid token")
+				return
+			}
+
+			if len(rule.Roles) > 0 && !claims.HasAnyRole(rule.Roles...) {
+				writeError(w, r, http.StatusForbidden, "FORBIDDEN", "You do not have the role required for this action")
+				return
+			}
+
+			for _, scope := range rule.Scopes {
+				if !claims.HasScope(scope) {
+					// RFC 6750 §3.1: tell the client which scope it lacks
+					w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+					writeError(w, r, http.StatusForbidden, "FORBIDDEN", "Token is missing the "+scope+" scope")
+					return
+				}
+			}
+
+			if rule.Owner != "" && r.PathValue(rule.Owner) != claims.Subject && !claims.HasAnyRole(RoleAdmin) {
+				writeError(w, r, http.StatusForbidden, "FORBIDDEN", "You can only access your own account")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HasAnyRole reports whether the token grants at least one of roles.
+// PHP equivalent: $this->isGranted('ROLE_ADMIN')
+func (c *Claims) HasAnyRole(roles ...string) bool {
+	for _, role := range roles {
+		if containsString(c.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the token's scope claim includes scope.
+func (c *Claims) HasScope(scope string) bool {
+	return containsString(strings.Fields(c.Scope), scope)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	mux := http.NewServeMux()
+	registerRoutes(mux, []Route{
+		{"GET /public", ok, Public},
+		{"GET /private", ok, Authenticated},
+		{"GET /admin", ok, AccessRule{Roles: []string{RoleAdmin}}},
+		{"GET /read", ok, AccessRule{Scopes: []string{ScopeUsersRead}}},
+		{"PUT /users/{id}", ok, AccessRule{Scopes: []string{ScopeUsersWrite}, Owner: "id"}},
+	})
+
+	user := &Claims{Subject: "1", Roles: []string{RoleUser}, Scope: "users:read users:write"}
+	admin := &Claims{Subject: "2", Roles: []string{RoleUser, RoleAdmin}, Scope: "users:read users:write"}
+	readOnly := &Claims{Subject: "1", Roles: []string{RoleUser}, Scope: "users:read"}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		claims *Claims
+		status int
+	}{
+		{"public, anonymous", "GET", "/public", nil, http.StatusOK},
+		{"authenticated, anonymous", "GET", "/private", nil, http.StatusUnauthorized},
+		{"authenticated, user", "GET", "/private", user, http.StatusOK},
+		{"role, user", "GET", "/admin", user, http.StatusForbidden},
+		{"role, admin", "GET", "/admin", admin, http.StatusOK},
+		{"scope present", "GET", "/read", readOnly, http.StatusOK},
+		{"scope missing", "PUT", "/users/1", readOnly, http.StatusForbidden},
+		{"owner", "PUT", "/users/1", user, http.StatusOK},
+		{"not owner", "PUT", "/users/2", user, http.StatusForbidden},
+		{"admin, not owner", "PUT", "/users/1", admin, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.claims != nil {
+				req = req.WithContext(WithClaims(req.Context(), tt.claims))
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status == http.StatusForbidden {
+				var apiErr APIError
+				decodeBody(t, rec, &apiErr)
+				if apiErr.Extensions["code"] != "FORBIDDEN" {
+					t.Errorf("error code = %v, want FORBIDDEN", apiErr.Extensions["code"])
+				}
+			}
+		})
+	}
+}
+
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, dst interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), dst); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body, err)
+	}
+}
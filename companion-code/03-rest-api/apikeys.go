@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/httpx"
+)
+
+// ErrAPIKeyInvalid is returned for unknown, malformed or expired API keys.
+var ErrAPIKeyInvalid = fmt.Errorf("%w: invalid API key", ErrUnauthorised)
+
+// apiKeyPrefix marks our keys so secret scanners and humans can spot them.
+const apiKeyPrefix = "ak_"
+
+// APIKey is a long-lived credential for service-to-service calls. It acts
+// for the user who minted it, within its scopes and without their roles.
+// Only a hash of the secret is kept; the full key is shown once, when minted.
+// PHP equivalent: an ApiToken entity checked by a custom authenticator
+type APIKey struct {
+	// ID is the public part of the key ("ak_" and 32 hex digits), safe to log and
+	// show in URLs; it identifies the key without revealing it.
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Hash       string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	OwnerID    int64      `json:"owner_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// CreateAPIKeyRequest is the request body for minting a key.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,dive,oneof=users:read users:write"`
+	ExpiresAt *time.Time `json:"expires_at" validate:"future"`
+}
+
+func init() {
+	// PHP equivalent: #[Assert\GreaterThan('now')]
+	validate.RegisterRule("future", func(v reflect.Value, _ string) bool {
+		t, ok := reflect.Indirect(v).Interface().(time.Time)
+		return ok && t.After(time.Now())
+	}, map[string]string{
+		"en": "{label} must be in the future",
+		"fr": "{label} doit être dans le futur",
+	})
+}
+
+// CreatedAPIKey is returned once, when a key is minted.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"` // The only time the full key is revealed
+}
+
+// apiKeyIDBytes is the randomness in a key ID: 128 bits, so IDs never
+// collide in practice. Create still refuses a duplicate rather than
+// replacing the key already stored under it.
+const apiKeyIDBytes = 16
+
+// APIKeyRepository stores API keys. APIKeyStore keeps them in memory and
+// PostgresAPIKeyRepository in PostgreSQL, next to the users; both pass the
+// same contract tests (apikeys_test.go).
+//
+// Lookups of a missing key return an error wrapping ErrNotFound, and
+// Create returns ErrConflict for an ID already in use. Returned keys are
+// copies: changing one does not change what is stored.
+// PHP equivalent: an ApiTokenRepository interface with a Doctrine implementation
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *APIKey) error
+	FindByID(ctx context.Context, id string) (*APIKey, error)
+	// List returns every key, newest first.
+	List(ctx context.Context) ([]APIKey, error)
+	// MarkUsed sets LastUsedAt.
+	MarkUsed(ctx context.Context, id string, at time.Time) error
+	Delete(ctx context.Context, id string) error
+}
+
+var (
+	_ APIKeyRepository = (*APIKeyStore)(nil)
+	_ APIKeyRepository = (*PostgresAPIKeyRepository)(nil)
+)
+
+// MintAPIKey creates a key and returns it with its plaintext secret.
+// Keys carry 256 random bits, so a fast hash is enough: unlike passwords
+// they cannot be guessed from a dictionary.
+func MintAPIKey(ctx context.Context, keys APIKeyRepository, req CreateAPIKeyRequest, ownerID int64) (CreatedAPIKey, error) {
+	// A clash needs a broken random source, but retry rather than fail
+	for attempt := 1; ; attempt++ {
+		id := apiKeyPrefix + randomHex(apiKeyIDBytes)
+		key := id + "." + randomToken()
+
+		k := &APIKey{
+			ID:        id,
+			Name:      req.Name,
+			Hash:      hashToken(key),
+			Scopes:    req.Scopes,
+			OwnerID:   ownerID,
+			CreatedAt: time.Now(),
+			ExpiresAt: req.ExpiresAt,
+		}
+		err := keys.Create(ctx, k)
+		if errors.Is(err, ErrConflict) && attempt < 3 {
+			continue
+		}
+		if err != nil {
+			return CreatedAPIKey{}, fmt.Errorf("mint API key: %w", err)
+		}
+		return CreatedAPIKey{APIKey: *k, Key: key}, nil
+	}
+}
+
+// AuthenticateAPIKey checks a presented key and records its use. Unknown,
+// malformed and expired keys all return ErrAPIKeyInvalid; other errors come
+// from the repository.
+func AuthenticateAPIKey(ctx context.Context, keys APIKeyRepository, key string, now time.Time) (*APIKey, error) {
+	id, _, ok := strings.Cut(key, ".")
+	if !ok || !strings.HasPrefix(id, apiKeyPrefix) {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	k, err := keys.FindByID(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hashToken(key))) != 1 {
+		return nil, ErrAPIKeyInvalid
+	}
+	if k.ExpiresAt != nil && !now.Before(*k.ExpiresAt) {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	// Last use is informational, so failing to record it fails nothing
+	if err := keys.MarkUsed(ctx, id, now); err != nil {
+		logf(ctx, "Recording use of API key %s: %v", id, err)
+	}
+	used := now
+	k.LastUsedAt = &used
+	return k, nil
+}
+
+// --- In-memory store ---
+
+// APIKeyStore is an APIKeyRepository that keeps keys in memory; they are
+// lost on restart. Use PostgresAPIKeyRepository (-store=postgres) to keep them.
+type APIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*APIKey // By ID
+}
+
+func NewAPIKeyStore() *APIKeyStore {
+	return &APIKeyStore{keys: make(map[string]*APIKey)}
+}
+
+func (s *APIKeyStore) Create(ctx context.Context, key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.keys[key.ID]; exists {
+		return fmt.Errorf("API key %s: %w", key.ID, ErrConflict)
+	}
+	s.keys[key.ID] = copyAPIKey(key)
+	return nil
+}
+
+func (s *APIKeyStore) FindByID(ctx context.Context, id string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("API key %s: %w", id, ErrNotFound)
+	}
+	return copyAPIKey(k), nil
+}
+
+func (s *APIKeyStore) List(ctx context.Context) ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, *copyAPIKey(k))
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (s *APIKeyStore) MarkUsed(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return fmt.Errorf("API key %s: %w", id, ErrNotFound)
+	}
+	k.LastUsedAt = &at
+	return nil
+}
+
+// Delete revokes a key; it stops working immediately.
+func (s *APIKeyStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[id]; !ok {
+		return fmt.Errorf("API key %s: %w", id, ErrNotFound)
+	}
+	delete(s.keys, id)
+	return nil
+}
+
+func copyAPIKey(k *APIKey) *APIKey {
+	c := *k
+	c.Scopes = append([]string(nil), k.Scopes...)
+	return &c
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// --- Middleware ---
+
+// APIKeyMiddleware authenticates requests carrying an X-API-Key header.
+// The key's owner and scopes become the request's claims, so routes are
+// guarded by the same AccessRules as for JWTs and Owner rules admit the
+// owner's own account. Keys hold no roles: they can never pass an
+// admin-only rule, including the ones guarding key management. A key
+// stops working when its owner is deleted.
+// PHP equivalent: a custom AbstractAuthenticator reading X-API-Key
+func APIKeyMiddleware(keys APIKeyRepository, users UserRepository) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("X-API-Key")
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if _, ok := ClaimsFromContext(r.Context()); ok {
+				writeError(w, r, http.StatusBadRequest, "BAD_REQUEST", "Send either a bearer token or an API key, not both")
+				return
+			}
+
+			k, err := AuthenticateAPIKey(r.Context(), keys, key, time.Now())
+			if errors.Is(err, ErrAPIKeyInvalid) {
+				logf(r.Context(), "API key rejected: %v", err)
+				writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid API key")
+				return
+			}
+			if err == nil {
+				if _, err = users.FindByID(r.Context(), k.OwnerID); errors.Is(err, ErrNotFound) {
+					logf(r.Context(), "API key %s rejected: owner %d no longer exists", k.ID, k.OwnerID)
+					writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid API key")
+					return
+				}
+			}
+			if err != nil {
+				writeErrorFor(w, r, err)
+				return
+			}
+
+			claims := &Claims{
+				Subject:  strconv.FormatInt(k.OwnerID, 10),
+				Scope:    strings.Join(k.Scopes, " "),
+				APIKeyID: k.ID,
+			}
+			next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// --- Handlers ---
+
+// ListAPIKeys returns every key without its secret.
+func (api *API) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := api.keys.List(r.Context())
+	if err != nil {
+		writeErrorFor(w, r, err)
+		return
+	}
+	httpx.Render(w, r, http.StatusOK, keys)
+}
+
+// GetAPIKey returns one key without its secret.
+func (api *API) GetAPIKey(w http.ResponseWriter, r *http.Request) {
+	k, err := api.keys.FindByID(r.Context(), r.PathValue("id"))
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, "NOT_FOUND", "API key not found")
+		return
+	}
+	if err != nil {
+		writeErrorFor(w, r, err)
+		return
+	}
+	httpx.Render(w, r, http.StatusOK, k)
+}
+
+// CreateAPIKey mints a key. The response is the only place the key appears.
+func (api *API) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+	if err := httpx.DecodeJSON(w, r, &req); err != nil {
+		httpx.WriteDecodeError(w, r, err)
+		return
+	}
+	if !validRequest(w, r, &req) {
+		return
+	}
+
+	// Only admins reach here, and only with a token, whose subject is a user ID
+	claims, _ := ClaimsFromContext(r.Context())
+	var created CreatedAPIKey
+	owner, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err == nil {
+		created, err = MintAPIKey(r.Context(), api.keys, req, owner)
+	}
+	if err != nil {
+		logf(r.Context(), "Internal error: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "An unexpected error occurred")
+		return
+	}
+	logf(r.Context(), "API key %s minted by user %s", created.ID, claims.Subject)
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Location", "/api-keys/"+created.ID)
+	httpx.Render(w, r, http.StatusCreated, created)
+}
+
+// RevokeAPIKey deletes a key.
+func (api *API) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := api.keys.Delete(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, "NOT_FOUND", "API key not found")
+		return
+	}
+	if err != nil {
+		writeErrorFor(w, r, err)
+		return
+	}
+	logf(r.Context(), "API key %s revoked", id)
+	w.WriteHeader(http.StatusNoContent)
+}
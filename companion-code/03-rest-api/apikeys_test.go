@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func login(t *testing.T, h http.Handler, email string) string {
+	t.Helper()
+	return decodePair(t, doJSON(t, h, http.MethodPost, "/auth/login", "", `{"email":"`+email+`","password":"correct-horse"}`)).AccessToken
+}
+
+func withAPIKey(h http.Handler, method, path, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("X-API-Key", key)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	h := newAuthServer(t)
+	admin := login(t, h, "admin@example.com")
+
+	rec := doJSON(t, h, http.MethodPost, "/api-keys", admin, `{"name":"nightly export","scopes":["users:read"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("mint: status = %d, want 201: %s", rec.Code, rec.Body)
+	}
+	var created CreatedAPIKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Key == "" || created.ID == "" || rec.Header().Get("Location") != "/api-keys/"+created.ID {
+		t.Fatalf("unexpected mint response %+v", created)
+	}
+
+	// The key works within its scopes only, and never for key management
+	if rec := withAPIKey(h, http.MethodGet, "/users", created.Key); rec.Code != http.StatusOK {
+		t.Errorf("GET /users with key: status = %d, want 200", rec.Code)
+	}
+	if rec := withAPIKey(h, http.MethodGet, "/api-keys", created.Key); rec.Code != http.StatusForbidden {
+		t.Errorf("GET /api-keys with key: status = %d, want 403", rec.Code)
+	}
+	if rec := withAPIKey(h, http.MethodGet, "/users", created.ID+".not-the-secret"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong secret: status = %d, want 401", rec.Code)
+	}
+
+	// Listing shows last use but never the secret
+	rec = doJSON(t, h, http.MethodGet, "/api-keys/"+created.ID, admin, "")
+	var listed map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := listed["key"]; ok {
+		t.Error("GET /api-keys/{id} leaked the key")
+	}
+	if listed["last_used_at"] == nil {
+		t.Error("last_used_at not recorded")
+	}
+
+	if rec := doJSON(t, h, http.MethodDelete, "/api-keys/"+created.ID, admin, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("revoke: status = %d, want 204", rec.Code)
+	}
+	if rec := withAPIKey(h, http.MethodGet, "/users", created.Key); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key: status = %d, want 401", rec.Code)
+	}
+}
+
+func TestAPIKeyActsForItsOwner(t *testing.T) {
+	h := newAuthServer(t)
+	admin := login(t, h, "admin@example.com")
+
+	// Alice is user 1 and the admin user 2
+	rec := doJSON(t, h, http.MethodPost, "/api-keys", admin, `{"name":"profile sync","scopes":["users:write"]}`)
+	var created CreatedAPIKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || created.OwnerID != 2 {
+		t.Fatalf("mint: %d %s", rec.Code, rec.Body)
+	}
+
+	patch := func(path string) int {
+		req := httptest.NewRequest(http.MethodPatch, path, strings.NewReader(`{"name":"Synced"}`))
+		req.Header.Set("Content-Type", mergePatchType)
+		req.Header.Set("X-API-Key", created.Key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Owner rules admit the owner's account, but the key has no admin role
+	if code := patch("/users/2"); code != http.StatusOK {
+		t.Errorf("PATCH own account: status = %d, want 200", code)
+	}
+	if code := patch("/users/1"); code != http.StatusForbidden {
+		t.Errorf("PATCH another account: status = %d, want 403", code)
+	}
+
+	// Deleting the owner disables the key
+	if rec := doJSON(t, h, http.MethodDelete, "/users/2", admin, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete owner: status = %d", rec.Code)
+	}
+	if rec := withAPIKey(h, http.MethodGet, "/users", created.Key); rec.Code != http.StatusUnauthorized {
+		t.Errorf("key of deleted owner: status = %d, want 401", rec.Code)
+	}
+}
+
+func TestCreateAPIKeyRules(t *testing.T) {
+	h := newAuthServer(t)
+	admin := login(t, h, "admin@example.com")
+	user := login(t, h, "alice@example.com")
+
+	tests := []struct {
+		name   string
+		token  string
+		body   string
+		status int
+	}{
+		{"not an admin", user, `{"name":"x","scopes":["users:read"]}`, http.StatusForbidden},
+		{"unknown scope", admin, `{"name":"x","scopes":["users:delete"]}`, http.StatusUnprocessableEntity},
+		{"no scopes", admin, `{"name":"x","scopes":[]}`, http.StatusUnprocessableEntity},
+		{"expiry in the past", admin, `{"name":"x","scopes":["users:read"],"expires_at":"2001-01-01T00:00:00Z"}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := doJSON(t, h, http.MethodPost, "/api-keys", tt.token, tt.body); rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+func TestAPIKeyExpiry(t *testing.T) {
+	ctx := context.Background()
+	keys := NewAPIKeyStore()
+	expires := time.Now().Add(time.Hour)
+	created, err := MintAPIKey(ctx, keys, CreateAPIKeyRequest{Name: "batch", Scopes: []string{ScopeUsersRead}, ExpiresAt: &expires}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := AuthenticateAPIKey(ctx, keys, created.Key, time.Now()); err != nil {
+		t.Fatalf("fresh key rejected: %v", err)
+	}
+	if _, err := AuthenticateAPIKey(ctx, keys, created.Key, expires.Add(time.Second)); err != ErrAPIKeyInvalid {
+		t.Errorf("expired key: err = %v, want ErrAPIKeyInvalid", err)
+	}
+}
+
+func TestMintAPIKeyID(t *testing.T) {
+	created, err := MintAPIKey(context.Background(), NewAPIKeyStore(), CreateAPIKeyRequest{Name: "x", Scopes: []string{ScopeUsersRead}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := len(apiKeyPrefix) + 2*apiKeyIDBytes; len(created.ID) != want || !strings.HasPrefix(created.Key, created.ID+".") {
+		t.Errorf("ID = %q, want %d characters prefixing the key %q", created.ID, want, created.Key)
+	}
+}
+
+func TestAPIKeyStoreContract(t *testing.T) {
+	testAPIKeyRepository(t, func(t *testing.T) APIKeyRepository { return NewAPIKeyStore() })
+}
+
+// TestPostgresAPIKeyRepositoryContract runs against the database named by
+// TEST_DATABASE_URL, in a schema per subtest like the users contract test.
+func TestPostgresAPIKeyRepositoryContract(t *testing.T) {
+	testAPIKeyRepository(t, func(t *testing.T) APIKeyRepository {
+		ctx := context.Background()
+		db := testSchema(t)
+		users := NewPostgresUserRepository(db)
+		if err := users.Migrate(ctx); err != nil {
+			t.Fatal(err)
+		}
+		// The keys' owner, user 1 in a fresh schema
+		if err := users.Create(ctx, &User{Name: "Owner", Email: "owner@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+		repo := NewPostgresAPIKeyRepository(db)
+		if err := repo.Migrate(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	})
+}
+
+// testAPIKeyRepository is the contract every APIKeyRepository must meet.
+// newRepo returns an empty repository.
+func testAPIKeyRepository(t *testing.T, newRepo func(t *testing.T) APIKeyRepository) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newKey := func(id string, createdAt time.Time) *APIKey {
+		return &APIKey{ID: id, Name: "export", Hash: "hash-" + id, Scopes: []string{ScopeUsersRead}, OwnerID: 1, CreatedAt: createdAt}
+	}
+
+	t.Run("create and find", func(t *testing.T) {
+		repo := newRepo(t)
+		expires := base.Add(time.Hour)
+		k := newKey("ak_1", base)
+		k.ExpiresAt = &expires
+		if err := repo.Create(ctx, k); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := repo.FindByID(ctx, "ak_1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, k) {
+			t.Errorf("FindByID = %+v, want %+v", got, k)
+		}
+
+		got.Scopes[0] = "changed"
+		if again, _ := repo.FindByID(ctx, "ak_1"); again.Scopes[0] != ScopeUsersRead {
+			t.Error("changing a returned key changed the stored one")
+		}
+	})
+
+	t.Run("duplicate ID is refused, not overwritten", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.Create(ctx, newKey("ak_1", base)); err != nil {
+			t.Fatal(err)
+		}
+		clash := newKey("ak_1", base)
+		clash.Hash = "other"
+		if err := repo.Create(ctx, clash); !errors.Is(err, ErrConflict) {
+			t.Fatalf("err = %v, want ErrConflict", err)
+		}
+		if got, _ := repo.FindByID(ctx, "ak_1"); got.Hash != "hash-ak_1" {
+			t.Errorf("Hash = %q, the first key was replaced", got.Hash)
+		}
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.FindByID(ctx, "ak_missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("FindByID err = %v, want ErrNotFound", err)
+		}
+		if err := repo.MarkUsed(ctx, "ak_missing", base); !errors.Is(err, ErrNotFound) {
+			t.Errorf("MarkUsed err = %v, want ErrNotFound", err)
+		}
+		if err := repo.Delete(ctx, "ak_missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Delete err = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("list newest first", func(t *testing.T) {
+		repo := newRepo(t)
+		if keys, err := repo.List(ctx); err != nil || len(keys) != 0 {
+			t.Fatalf("List = %v, %v, want empty", keys, err)
+		}
+		for i, id := range []string{"ak_old", "ak_new", "ak_mid"} {
+			created := []time.Time{base, base.Add(2 * time.Hour), base.Add(time.Hour)}[i]
+			if err := repo.Create(ctx, newKey(id, created)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		keys, err := repo.List(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, k := range keys {
+			ids = append(ids, k.ID)
+		}
+		if want := []string{"ak_new", "ak_mid", "ak_old"}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("List = %v, want %v", ids, want)
+		}
+	})
+
+	t.Run("mark used and delete", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.Create(ctx, newKey("ak_1", base)); err != nil {
+			t.Fatal(err)
+		}
+		used := base.Add(time.Minute)
+		if err := repo.MarkUsed(ctx, "ak_1", used); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := repo.FindByID(ctx, "ak_1"); got.LastUsedAt == nil || !got.LastUsedAt.Equal(used) {
+			t.Errorf("LastUsedAt = %v, want %v", got.LastUsedAt, used)
+		}
+
+		if err := repo.Delete(ctx, "ak_1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.FindByID(ctx, "ak_1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("after Delete: err = %v, want ErrNotFound", err)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/httpx"
+)
+
+// LoginRequest is the request body for POST /auth/login.
+// PHP equivalent: the json_login authenticator's username/password payload
+type LoginRequest struct {
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// RefreshRequest is the request body for POST /auth/refresh and, optionally, POST /auth/logout.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// Login checks credentials and returns an access/refresh token pair.
+// PHP equivalent: json_login firewall + Lexik's AuthenticationSuccessHandler
+func (api *API) Login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := httpx.DecodeJSON(w, r, &req); err != nil {
+		httpx.WriteDecodeError(w, r, err)
+		return
+	}
+
+	if !validRequest(w, r, &req) {
+		return
+	}
+
+	// Unknown users are checked against a dummy hash so response times
+	// do not reveal which emails have accounts
+	user, err := api.users.FindByEmail(r.Context(), req.Email)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		writeErrorFor(w, r, err)
+		return
+	}
+	hash := api.passwords.dummy
+	if user != nil {
+		hash = user.Password
+	}
+
+	// PHP equivalent: $hasher->isPasswordValid($user, $password)
+	ok, err := api.passwords.Verify(req.Password, hash)
+	if err != nil && user != nil {
+		logf(r.Context(), "Verify password for user %d: %v", user.ID, err)
+	}
+	if user == nil || !ok {
+		writeError(w, r, http.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid email or password")
+		return
+	}
+
+	// Upgrade bcrypt hashes from the PHP app, and argon2id hashes with old
+	// parameters, now that we have the plaintext
+	// PHP equivalent: PasswordUpgraderInterface::upgradePassword()
+	if api.passwords.NeedsRehash(user.Password) {
+		if newHash, err := api.passwords.Hash(req.Password); err != nil {
+			logf(r.Context(), "Rehash password for user %d: %v", user.ID, err)
+		} else if _, err := api.users.Update(r.Context(), user.ID, func(u *User) error {
+			u.Password = newHash
+			return nil
+		}); err != nil {
+			logf(r.Context(), "Save rehashed password for user %d: %v", user.ID, err)
+		}
+	}
+
+	pair, err := api.tokens.Issue(r.Context(), user)
+	if err != nil {
+		logf(r.Context(), "Issue token: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "An unexpected error occurred")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httpx.Render(w, r, http.StatusOK, pair)
+}
+
+// Refresh rotates a refresh token into a new token pair.
+// PHP equivalent: gesdinet_jwt_refresh_token with single_use: true
+func (api *API) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := httpx.DecodeJSON(w, r, &req); err != nil {
+		httpx.WriteDecodeError(w, r, err)
+		return
+	}
+	if !validRequest(w, r, &req) {
+		return
+	}
+
+	pair, err := api.tokens.Refresh(r.Context(), req.RefreshToken)
+	switch {
+	case errors.Is(err, ErrRefreshTokenReused):
+		logf(r.Context(), "Refresh token reuse detected; session revoked")
+		writeError(w, r, http.StatusUnauthorized, "INVALID_REFRESH_TOKEN", "Refresh token has already been used; please log in again")
+		return
+	case errors.Is(err, ErrUnauthorised):
+		writeError(w, r, http.StatusUnauthorized, "INVALID_REFRESH_TOKEN", "Invalid or expired refresh token")
+		return
+	case err != nil:
+		logf(r.Context(), "Refresh token: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "An unexpected error occurred")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httpx.Render(w, r, http.StatusOK, pair)
+}
+
+// Logout revokes the caller's access token and, when the body names one,
+// its refresh token session.
+// PHP equivalent: the logout firewall listener adding the token to the blocklist
+func (api *API) Logout(w http.ResponseWriter, r *http.Request) {
+	claims, ok := ClaimsFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Missing or invalid token")
+		return
+	}
+	// There is no session behind an API key; answering 204 would suggest
+	// the key stopped working
+	if claims.APIKeyID != "" {
+		writeError(w, r, http.StatusBadRequest, "BAD_REQUEST", "API keys cannot log out; revoke the key with DELETE /api-keys/"+claims.APIKeyID)
+		return
+	}
+
+	// The body is optional: without it only the access token is revoked
+	var req RefreshRequest
+	if r.ContentLength != 0 {
+		if err := httpx.DecodeJSON(w, r, &req); err != nil {
+			httpx.WriteDecodeError(w, r, err)
+			return
+		}
+	}
+
+	if err := api.tokens.Revoke(r.Context(), claims, req.RefreshToken); err != nil {
+		logf(r.Context(), "Revoke token: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "An unexpected error occurred")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newAuthServer wires the full route table behind both authenticators with a user and an admin,
+// both with the password "correct-horse".
+func newAuthServer(t *testing.T) http.Handler {
+	t.Helper()
+
+	cfg := JWTConfig{Secret: testSecret, AccessTTL: time.Minute, RefreshTTL: time.Hour, Denylist: NewMemoryDenylist()}
+	verifier, err := NewJWTVerifier(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := NewUserStore()
+	tokens, err := NewTokenService(cfg, users, NewMemoryRefreshStore(), cfg.Denylist)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passwords := newTestHasher(t)
+	hash, err := passwords.Hash("correct-horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*User{
+		{Name: "Alice", Email: "alice@example.com", Password: hash, Roles: []string{RoleUser}},
+		{Name: "Admin", Email: "admin@example.com", Password: hash, Roles: []string{RoleUser, RoleAdmin}},
+	} {
+		if err := users.Create(context.Background(), u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys := NewAPIKeyStore()
+	api := NewAPI(users, tokens, passwords, keys)
+
+	mux := http.NewServeMux()
+	registerRoutes(mux, api.Routes())
+	return AuthMiddleware(verifier)(APIKeyMiddleware(keys, users)(mux))
+}
+
+func doJSON(t *testing.T, h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodePair(t *testing.T, rec *httptest.ResponseRecorder) TokenPair {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var pair TokenPair
+	if err := json.Unmarshal(rec.Body.Bytes(), &pair); err != nil {
+		t.Fatal(err)
+	}
+	if pair.AccessToken == "" || pair.RefreshToken == "" || pair.TokenType != "Bearer" || pair.ExpiresIn != 60 {
+		t.Fatalf("unexpected token pair %+v", pair)
+	}
+	return pair
+}
+
+func TestLogin(t *testing.T) {
+	h := newAuthServer(t)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"valid", `{"email":"Alice@Example.com","password":"correct-horse"}`, http.StatusOK},
+		{"wrong password", `{"email":"alice@example.com","password":"wrong"}`, http.StatusUnauthorized},
+		{"unknown user", `{"email":"bob@example.com","password":"correct-horse"}`, http.StatusUnauthorized},
+		{"missing fields", `{}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, h, http.MethodPost, "/auth/login", "", tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+func TestRefreshRotationAndReuse(t *testing.T) {
+	h := newAuthServer(t)
+
+	first := decodePair(t, doJSON(t, h, http.MethodPost, "/auth/login", "", `{"email":"alice@example.com","password":"correct-horse"}`))
+
+	second := decodePair(t, doJSON(t, h, http.MethodPost, "/auth/refresh", "", `{"refresh_token":"`+first.RefreshToken+`"}`))
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh token was not rotated")
+	}
+	if rec := doJSON(t, h, http.MethodGet, "/users", second.AccessToken, ""); rec.Code != http.StatusOK {
+		t.Fatalf("new access token rejected: %d", rec.Code)
+	}
+
+	// Replaying the rotated token revokes the whole family, including the newest token
+	if rec := doJSON(t, h, http.MethodPost, "/auth/refresh", "", `{"refresh_token":"`+first.RefreshToken+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("reused token: status = %d, want 401", rec.Code)
+	}
+	if rec := doJSON(t, h, http.MethodPost, "/auth/refresh", "", `{"refresh_token":"`+second.RefreshToken+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("token from revoked family: status = %d, want 401", rec.Code)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	h := newAuthServer(t)
+
+	pair := decodePair(t, doJSON(t, h, http.MethodPost, "/auth/login", "", `{"email":"alice@example.com","password":"correct-horse"}`))
+
+	rec := doJSON(t, h, http.MethodPost, "/auth/logout", pair.AccessToken, `{"refresh_token":"`+pair.RefreshToken+`"}`)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("logout: status = %d, want 204: %s", rec.Code, rec.Body)
+	}
+
+	if rec := doJSON(t, h, http.MethodGet, "/users", pair.AccessToken, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked access token: status = %d, want 401", rec.Code)
+	}
+	if rec := doJSON(t, h, http.MethodPost, "/auth/refresh", "", `{"refresh_token":"`+pair.RefreshToken+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked refresh token: status = %d, want 401", rec.Code)
+	}
+}
+
+// TestLogoutWithAPIKey tests that logging out with an API key is refused
+// rather than reported as done, and leaves the key working.
+func TestLogoutWithAPIKey(t *testing.T) {
+	h := newAuthServer(t)
+	admin := login(t, h, "admin@example.com")
+
+	var created CreatedAPIKey
+	rec := doJSON(t, h, http.MethodPost, "/api-keys", admin, `{"name":"deploy","scopes":["users:read"]}`)
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("mint: %v: %s", err, rec.Body)
+	}
+
+	if rec := withAPIKey(h, http.MethodPost, "/auth/logout", created.Key); rec.Code != http.StatusBadRequest {
+		t.Errorf("logout with key: status = %d, want 400: %s", rec.Code, rec.Body)
+	}
+	if rec := withAPIKey(h, http.MethodGet, "/users", created.Key); rec.Code != http.StatusOK {
+		t.Errorf("key after logout attempt: status = %d, want 200", rec.Code)
+	}
+}
@@ -1,3 +1,22 @@
 module github.com/Dr-H-PhD/recompiling-your-mind-code/03-rest-api
 
 go 1.22
+
+require (
+	github.com/Dr-H-PhD/recompiling-your-mind-code/internal v0.0.0
+	github.com/alicebob/miniredis/v2 v2.34.0
+	github.com/lib/pq v1.10.9
+	github.com/redis/go-redis/v9 v9.7.3
+	golang.org/x/crypto v0.33.0
+)
+
+require (
+	github.com/alicebob/gopher-json v0.0.0-20230218143504-906a9b012302 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+)
+
+// The helpers shared by every example live in ../internal
+replace github.com/Dr-H-PhD/recompiling-your-mind-code/internal => ../internal
@@ -0,0 +1,20 @@
+package main
+
+import "net/http"
+
+// idempotencyPrincipal scopes Idempotency-Key entries to the caller, so one
+// client can never replay another's response. Token holders are identified
+// by subject, which survives a token refresh between retries. Anonymous
+// callers share a scope; their keys must be unguessable, which random
+// UUIDs are.
+func idempotencyPrincipal(r *http.Request) string {
+	claims, ok := ClaimsFromContext(r.Context())
+	switch {
+	case ok && claims.APIKeyID != "":
+		return "key:" + claims.APIKeyID
+	case ok:
+		return "user:" + claims.Subject
+	default:
+		return "anonymous"
+	}
+}
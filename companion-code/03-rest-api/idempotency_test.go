@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/httpx"
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/userlist"
+)
+
+func TestIdempotencyPrincipal(t *testing.T) {
+	principal := func(claims *Claims) string {
+		req := httptest.NewRequest(http.MethodPost, "/users", nil)
+		if claims != nil {
+			req = req.WithContext(WithClaims(req.Context(), claims))
+		}
+		return idempotencyPrincipal(req)
+	}
+
+	// A refreshed token has a new ID but the same subject
+	if before, after := principal(&Claims{Subject: "1", ID: "jti-1"}), principal(&Claims{Subject: "1", ID: "jti-2"}); before != after {
+		t.Errorf("principal changed across a token refresh: %q, then %q", before, after)
+	}
+
+	seen := map[string]string{}
+	for name, claims := range map[string]*Claims{
+		"anonymous":          nil,
+		"user 1":             {Subject: "1"},
+		"user 2":             {Subject: "2"},
+		"user 1's key":       {Subject: "1", APIKeyID: "ak_1"},
+		"user 1's other key": {Subject: "1", APIKeyID: "ak_2"},
+	} {
+		p := principal(claims)
+		if other, dup := seen[p]; dup {
+			t.Errorf("%s and %s share the principal %q", name, other, p)
+		}
+		seen[p] = name
+	}
+}
+
+// TestCreateUserIdempotent checks the case that motivated the middleware:
+// a retried registration creates one user.
+func TestCreateUserIdempotent(t *testing.T) {
+	users := NewUserStore()
+	api := NewAPI(users, nil, newTestHasher(t), nil)
+	mux := http.NewServeMux()
+	registerRoutes(mux, api.Routes())
+	h := httpx.IdempotencyMiddleware(httpx.NewMemoryIdempotencyStore(time.Hour), idempotencyPrincipal)(mux)
+
+	body := `{"name":"Alice","email":"alice@example.com","password":"correct-horse"}`
+	var bodies []string
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "0190a0b2-6c4e-7d2a-9f3e-1a2b3c4d5e6f")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("attempt %d: status = %d: %s", i+1, rec.Code, rec.Body)
+		}
+		bodies = append(bodies, rec.Body.String())
+	}
+
+	if bodies[0] != bodies[1] {
+		t.Errorf("retry body %s differs from %s", bodies[1], bodies[0])
+	}
+	if list, _, _ := users.List(context.Background(), userlist.Query{Sort: "id", Limit: 10}); len(list) != 1 {
+		t.Errorf("%d users created, want 1", len(list))
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// Token errors. All of them wrap ErrUnauthorised so callers can treat
+// any verification failure as a 401 with a single errors.Is check.
+var (
+	ErrTokenMalformed   = fmt.Errorf("%w: malformed token", ErrUnauthorised)
+	ErrTokenAlgorithm   = fmt.Errorf("%w: unsupported signing algorithm", ErrUnauthorised)
+	ErrTokenUnknownKey  = fmt.Errorf("%w: unknown signing key", ErrUnauthorised)
+	ErrTokenSignature   = fmt.Errorf("%w: invalid signature", ErrUnauthorised)
+	ErrTokenExpired     = fmt.Errorf("%w: token has expired", ErrUnauthorised)
+	ErrTokenNoExpiry    = fmt.Errorf("%w: token has no expiry", ErrUnauthorised)
+	ErrTokenNotYetValid = fmt.Errorf("%w: token is not valid yet", ErrUnauthorised)
+	ErrTokenIssuer      = fmt.Errorf("%w: unexpected issuer", ErrUnauthorised)
+	ErrTokenAudience    = fmt.Errorf("%w: unexpected audience", ErrUnauthorised)
+	ErrTokenRevoked     = fmt.Errorf("%w: token has been revoked", ErrUnauthorised)
+)
+
+// JWTConfig controls how bearer tokens are issued and verified.
+// PHP equivalent: lexik_jwt_authentication.yaml
+type JWTConfig struct {
+	// Secret verifies HS256 tokens. Leave empty to refuse HS256.
+	Secret []byte
+	// JWKSFile is a local JSON Web Key Set holding RS256/ES256 public keys.
+	JWKSFile string
+	// Issuer and Audience are checked against iss and aud when set.
+	Issuer   string
+	Audience string
+	// ClockSkew is the leeway allowed on exp and nbf for drifting clocks.
+	ClockSkew time.Duration
+	// AccessTTL and RefreshTTL are the lifetimes of issued tokens.
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	// Denylist, when set, is consulted for revoked token IDs (jti).
+	Denylist Denylist
+}
+
+// LoadJWTConfig reads the token settings from the environment.
+// JWT_SECRET has no default: a well-known secret would let anyone sign
+// tokens with any roles, so without it HS256 is refused.
+func LoadJWTConfig() JWTConfig {
+	return JWTConfig{
+		Secret:     []byte(os.Getenv("JWT_SECRET")),
+		JWKSFile:   os.Getenv("JWT_JWKS_FILE"),
+		Issuer:     os.Getenv("JWT_ISSUER"),
+		Audience:   os.Getenv("JWT_AUDIENCE"),
+		ClockSkew:  envDuration("JWT_CLOCK_SKEW", 30*time.Second),
+		AccessTTL:  envDuration("JWT_ACCESS_TTL", 15*time.Minute),
+		RefreshTTL: envDuration("JWT_REFRESH_TTL", 30*24*time.Hour),
+	}
+}
+
+// envDuration parses a duration such as "15m" from the environment.
+func envDuration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
+
+// Claims are the verified contents of a token.
+// PHP equivalent: the payload array from JWTTokenManagerInterface::parse()
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	Scope     string   `json:"scope,omitempty"` // Space-separated, as in OAuth 2.0
+	// APIKeyID is set when the caller authenticated with an API key rather
+	// than a token; Subject is then the ID of the user who owns the key.
+	APIKeyID string `json:"-"`
+}
+
+// audience accepts "aud" as either a single string or an array (RFC 7519 §4.1.3).
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// JWTVerifier checks signatures and registered claims.
+// PHP equivalent: Lexik's JWTEncoder, configured once and injected as a service
+type JWTVerifier struct {
+	cfg  JWTConfig
+	keys map[string]crypto.PublicKey // By kid
+	now  func() time.Time
+}
+
+// NewJWTVerifier loads the JWKS file, if any, and returns a verifier.
+func NewJWTVerifier(cfg JWTConfig) (*JWTVerifier, error) {
+	v := &JWTVerifier{cfg: cfg, keys: make(map[string]crypto.PublicKey), now: time.Now}
+
+	if cfg.JWKSFile != "" {
+		data, err := os.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("read JWKS: %w", err)
+		}
+		if v.keys, err = parseJWKS(data); err != nil {
+			return nil, fmt.Errorf("parse JWKS %s: %w", cfg.JWKSFile, err)
+		}
+	}
+
+	if len(cfg.Secret) == 0 && len(v.keys) == 0 {
+		return nil, errors.New("JWT verification needs a secret or a JWKS file")
+	}
+	return v, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Verify parses a compact JWS and returns its claims if the signature and
+// the exp, nbf, iss and aud claims are all valid and the token is not revoked.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrTokenMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+
+	if err := v.verifySignature(header, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	// Only look at the payload once we know who signed it
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrTokenMalformed
+	}
+	if err := v.validateClaims(&claims); err != nil {
+		return nil, err
+	}
+
+	if v.cfg.Denylist != nil && claims.ID != "" {
+		revoked, err := v.cfg.Denylist.IsRevoked(ctx, claims.ID)
+		if err != nil {
+			return nil, fmt.Errorf("check denylist: %w", err)
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return &claims, nil
+}
+
+// signHS256 encodes claims as a compact JWS signed with secret.
+// PHP equivalent: JWTTokenManagerInterface::create() / JWT::encode($payload, $key, 'HS256')
+func signHS256(secret []byte, claims interface{}) (string, error) {
+	header, err := json.Marshal(jwtHeader{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifySignature checks sig over signed with the algorithm the header names.
+// The algorithm decides which kind of key is used, and each key type only
+// serves its own algorithm, so a public key can never be used as an HMAC
+// secret ("alg confusion") and "none" is never accepted.
+func (v *JWTVerifier) verifySignature(header jwtHeader, signed string, sig []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+
+	switch header.Alg {
+	case "HS256":
+		if len(v.cfg.Secret) == 0 {
+			return ErrTokenAlgorithm
+		}
+		mac := hmac.New(sha256.New, v.cfg.Secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrTokenSignature
+		}
+		return nil
+
+	case "RS256":
+		key, ok := v.keys[header.Kid].(*rsa.PublicKey)
+		if !ok {
+			return ErrTokenUnknownKey
+		}
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) != nil {
+			return ErrTokenSignature
+		}
+		return nil
+
+	case "ES256":
+		key, ok := v.keys[header.Kid].(*ecdsa.PublicKey)
+		if !ok || key.Curve != elliptic.P256() {
+			return ErrTokenUnknownKey
+		}
+		// JWS uses the fixed-size r||s form, not ASN.1 (RFC 7518 §3.4)
+		if len(sig) != 64 {
+			return ErrTokenSignature
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			return ErrTokenSignature
+		}
+		return nil
+	}
+
+	return ErrTokenAlgorithm
+}
+
+// validateClaims checks the time window, issuer and audience. Tokens
+// without exp are refused, since they would never expire.
+func (v *JWTVerifier) validateClaims(c *Claims) error {
+	now := v.now()
+
+	if c.ExpiresAt == 0 {
+		return ErrTokenNoExpiry
+	}
+	if now.Add(-v.cfg.ClockSkew).After(time.Unix(c.ExpiresAt, 0)) {
+		return ErrTokenExpired
+	}
+	if c.NotBefore != 0 && now.Add(v.cfg.ClockSkew).Before(time.Unix(c.NotBefore, 0)) {
+		return ErrTokenNotYetValid
+	}
+	if v.cfg.Issuer != "" && c.Issuer != v.cfg.Issuer {
+		return ErrTokenIssuer
+	}
+	if v.cfg.Audience != "" && !containsString(c.Audience, v.cfg.Audience) {
+		return ErrTokenAudience
+	}
+	return nil
+}
+
+// decodeSegment decodes one base64url JSON part of a token.
+func decodeSegment(seg string, dst interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// --- JWKS ---
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS reads the RSA and P-256 signing keys from a JWK Set (RFC 7517).
+// Keys of other types are skipped so a shared JWKS file can hold them.
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var (
+			key crypto.PublicKey
+			err error
+		)
+		switch k.Kty {
+		case "RSA":
+			key, err = k.rsaKey()
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			key, err = k.ecKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %d (%q): %w", i, k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jwk) rsaKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("exponent: %w", err)
+	}
+	exp := new(big.Int).SetBytes(e)
+	if len(n) == 0 || !exp.IsInt64() || exp.Int64() < 3 {
+		return nil, errors.New("invalid RSA key")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+}
+
+func (k jwk) ecKey() (*ecdsa.PublicKey, error) {
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("x: %w", err)
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("y: %w", err)
+	}
+	key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("point is not on P-256")
+	}
+	return key, nil
+}
+
+// --- Request context ---
+
+type claimsKey struct{}
+
+// WithClaims returns a copy of ctx carrying the verified claims.
+func WithClaims(ctx context.Context, c *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, c)
+}
+
+// ClaimsFromContext returns the claims AuthMiddleware stored for the request.
+// PHP equivalent: $this->getUser() / $tokenStorage->getToken()
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	c, ok := ctx.Value(claimsKey{}).(*Claims)
+	return c, ok
+}
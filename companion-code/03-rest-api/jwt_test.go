@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("test-secret-of-at-least-32-bytes")
+
+// signToken builds a compact JWS for header and claims, signed with key:
+// a []byte secret for HS256, *rsa.PrivateKey for RS256, *ecdsa.PrivateKey for ES256.
+func signToken(t *testing.T, header map[string]string, claims interface{}, key interface{}) string {
+	t.Helper()
+
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// writeJWKS saves the public halves of the keys as a JWK Set and returns its path.
+func writeJWKS(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) string {
+	t.Helper()
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	set := map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "oct", "kid": "ignored"},
+	}}
+	data, _ := json.Marshal(set)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestJWTVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1_700_000_000, 0)
+	v, err := NewJWTVerifier(JWTConfig{
+		Secret:    testSecret,
+		JWKSFile:  writeJWKS(t, rsaKey, ecKey),
+		Issuer:    "https://auth.example.com",
+		Audience:  "user-api",
+		ClockSkew: 30 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.now = func() time.Time { return now }
+
+	claims := func(mod func(map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "42",
+			"iss": "https://auth.example.com",
+			"aud": []string{"user-api", "other"},
+			"exp": now.Add(time.Minute).Unix(),
+			"nbf": now.Add(-time.Minute).Unix(),
+		}
+		if mod != nil {
+			mod(c)
+		}
+		return c
+	}
+	hs := map[string]string{"alg": "HS256", "typ": "JWT"}
+	rs := map[string]string{"alg": "RS256", "kid": "rsa-1"}
+	es := map[string]string{"alg": "ES256", "kid": "ec-1"}
+
+	otherRSA, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"HS256", signToken(t, hs, claims(nil), testSecret), nil},
+		{"RS256", signToken(t, rs, claims(nil), rsaKey), nil},
+		{"ES256", signToken(t, es, claims(nil), ecKey), nil},
+		{"single audience string", signToken(t, hs, claims(func(c map[string]interface{}) { c["aud"] = "user-api" }), testSecret), nil},
+		{"expired within skew", signToken(t, hs, claims(func(c map[string]interface{}) { c["exp"] = now.Add(-20 * time.Second).Unix() }), testSecret), nil},
+		{"no expiry", signToken(t, hs, claims(func(c map[string]interface{}) { delete(c, "exp") }), testSecret), ErrTokenNoExpiry},
+		{"expired", signToken(t, hs, claims(func(c map[string]interface{}) { c["exp"] = now.Add(-time.Minute).Unix() }), testSecret), ErrTokenExpired},
+		{"not yet valid", signToken(t, hs, claims(func(c map[string]interface{}) { c["nbf"] = now.Add(time.Minute).Unix() }), testSecret), ErrTokenNotYetValid},
+		{"wrong issuer", signToken(t, hs, claims(func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }), testSecret), ErrTokenIssuer},
+		{"wrong audience", signToken(t, hs, claims(func(c map[string]interface{}) { c["aud"] = "billing" }), testSecret), ErrTokenAudience},
+		{"wrong secret", signToken(t, hs, claims(nil), []byte("guess")), ErrTokenSignature},
+		{"wrong RSA key", signToken(t, rs, claims(nil), otherRSA), ErrTokenSignature},
+		{"unknown kid", signToken(t, map[string]string{"alg": "RS256", "kid": "nope"}, claims(nil), rsaKey), ErrTokenUnknownKey},
+		{"RSA kid with ES256", signToken(t, map[string]string{"alg": "ES256", "kid": "rsa-1"}, claims(nil), ecKey), ErrTokenUnknownKey},
+		{"alg none", signToken(t, map[string]string{"alg": "none"}, claims(nil), []byte{}), ErrTokenAlgorithm},
+		{"not a JWT", "valid-token", ErrTokenMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.Verify(context.Background(), tt.token)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if tt.want != nil {
+				if !errors.Is(err, ErrUnauthorised) {
+					t.Errorf("%v does not wrap ErrUnauthorised", err)
+				}
+				return
+			}
+			if got.Subject != "42" {
+				t.Errorf("sub = %q, want 42", got.Subject)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierRequiresKeys(t *testing.T) {
+	if _, err := NewJWTVerifier(JWTConfig{}); err == nil {
+		t.Error("expected an error without a secret or JWKS file")
+	}
+}
+
+func TestLoadJWTConfigHasNoDefaultSecret(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+	cfg := LoadJWTConfig()
+	if len(cfg.Secret) != 0 {
+		t.Fatalf("Secret = %q, want none", cfg.Secret)
+	}
+	if _, err := NewTokenService(cfg, nil, nil, nil); err == nil {
+		t.Error("tokens were issued without JWT_SECRET")
+	}
+	cfg.Secret = []byte("short")
+	if _, err := NewTokenService(cfg, nil, nil, nil); err == nil {
+		t.Error("tokens were issued with a short JWT_SECRET")
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	v, err := NewJWTVerifier(JWTConfig{Secret: testSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seen *Claims
+	handler := AuthMiddleware(v)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = ClaimsFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	token := signToken(t, map[string]string{"alg": "HS256"},
+		map[string]interface{}{"sub": "7", "roles": []string{"ROLE_ADMIN"}, "exp": time.Now().Add(time.Hour).Unix()}, testSecret)
+
+	tests := []struct {
+		name   string
+		path   string
+		auth   string
+		status int
+	}{
+		{"anonymous", "/users", "", http.StatusOK}, // Left to the route's AccessRule
+		{"not a bearer token", "/users", "Basic YWxpY2U6c2VjcmV0", http.StatusUnauthorized},
+		{"bad token", "/users", "Bearer valid-token", http.StatusUnauthorized},
+		{"valid token", "/users", "Bearer " + token, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = nil
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+
+	if seen == nil || seen.Subject != "7" || len(seen.Roles) != 1 || seen.Roles[0] != "ROLE_ADMIN" {
+		t.Errorf("claims in context = %+v", seen)
+	}
+}
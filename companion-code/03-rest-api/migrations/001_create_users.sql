@@ -0,0 +1,28 @@
+-- Schema for PostgresUserRepository, applied by its Migrate method.
+-- Every statement is idempotent, so it is safe to run at each startup.
+
+CREATE TABLE IF NOT EXISTS users (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    password VARCHAR(255) NOT NULL DEFAULT '',
+    roles TEXT[] NOT NULL DEFAULT '{ROLE_USER}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Emails are unique regardless of case
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users(lower(email));
+
+-- Keyset pagination: one index per sort field, ties broken by id
+CREATE INDEX IF NOT EXISTS idx_users_name_id ON users(name COLLATE "C", id);
+CREATE INDEX IF NOT EXISTS idx_users_email_id ON users(email COLLATE "C", id);
+CREATE INDEX IF NOT EXISTS idx_users_created_at_id ON users(created_at, id);
+
+-- When the table last changed, including deletes, which MAX(updated_at) misses.
+-- A single row, updated in the same transaction as every write.
+CREATE TABLE IF NOT EXISTS users_modified (
+    singleton BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (singleton),
+    modified_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+INSERT INTO users_modified DEFAULT VALUES ON CONFLICT DO NOTHING;
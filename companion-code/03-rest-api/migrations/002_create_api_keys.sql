@@ -0,0 +1,18 @@
+-- Schema for PostgresAPIKeyRepository, applied by its Migrate method.
+-- Every statement is idempotent, so it is safe to run at each startup.
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id VARCHAR(64) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    hash VARCHAR(128) NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    owner_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Listing is newest first
+CREATE INDEX IF NOT EXISTS idx_api_keys_created_at ON api_keys(created_at);
+-- Deleting a user cascades to their keys
+CREATE INDEX IF NOT EXISTS idx_api_keys_owner_id ON api_keys(owner_id);
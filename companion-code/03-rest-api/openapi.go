@@ -0,0 +1,518 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/userlist"
+)
+
+// apiVersion is the version reported by GET / and the OpenAPI document.
+const apiVersion = "1.0.0"
+
+// RouteDoc describes a route for the OpenAPI document. Request and Response
+// are zero values of the body types, e.g. CreateUserRequest{} or []User{};
+// their schemas are derived from the json and validate tags.
+// PHP equivalent: #[OA\Post(...)] attributes read by NelmioApiDocBundle
+type RouteDoc struct {
+	Summary     string
+	Description string
+	Tag         string
+
+	Request         interface{}
+	RequestType     string // Defaults to application/json
+	RequestOptional bool
+
+	Status       int // Success status; defaults to 200
+	Response     interface{}
+	ResponseType string // Defaults to application/json
+
+	Params []OpenAPIParam
+}
+
+// OpenAPIParam is a query or path parameter. Path parameters not listed
+// are documented as strings.
+type OpenAPIParam struct {
+	Name        string
+	In          string // "query" or "path"
+	Description string
+	Schema      map[string]interface{}
+}
+
+var userIDParam = OpenAPIParam{Name: "id", In: "path", Schema: map[string]interface{}{"type": "integer", "format": "int64", "minimum": 1}}
+
+var apiKeyIDParam = OpenAPIParam{Name: "id", In: "path", Schema: map[string]interface{}{"type": "string", "pattern": "^" + apiKeyPrefix + "[0-9a-f]+$"}}
+
+// userListParams are the parameters userlist.Parse reads.
+var userListParams = []OpenAPIParam{
+	{Name: "limit", In: "query", Description: "Page size", Schema: map[string]interface{}{"type": "integer", "minimum": 1, "maximum": userlist.MaxPageSize, "default": userlist.DefaultPageSize}},
+	{Name: "cursor", In: "query", Description: "Opaque position from the previous page's Link header", Schema: map[string]interface{}{"type": "string"}},
+	{Name: "sort", In: "query", Schema: map[string]interface{}{"type": "string", "enum": userlist.SortFields, "default": "id"}},
+	{Name: "order", In: "query", Schema: map[string]interface{}{"type": "string", "enum": []string{"asc", "desc"}, "default": "asc"}},
+	{Name: "name", In: "query", Description: "Name contains, ignoring case", Schema: map[string]interface{}{"type": "string"}},
+	{Name: "email_domain", In: "query", Description: "Email domain, ignoring case", Schema: map[string]interface{}{"type": "string"}},
+	{Name: "created_after", In: "query", Description: "Exclusive lower bound", Schema: map[string]interface{}{"type": "string", "format": "date-time"}},
+	{Name: "created_before", In: "query", Description: "Exclusive upper bound", Schema: map[string]interface{}{"type": "string", "format": "date-time"}},
+}
+
+// routeDocs documents every route in API.Routes, by pattern. A test fails
+// if a route is missing here, so the document cannot fall behind.
+var routeDocs = map[string]RouteDoc{
+	"GET /{$}":          {Tag: "service", Summary: "Describe the service", Response: map[string]string{}},
+	"GET /health":       {Tag: "service", Summary: "Report that the process is up", Response: map[string]string{}},
+	"GET /openapi.json": {Tag: "service", Summary: "This OpenAPI document", Response: map[string]interface{}{}},
+	"GET /docs":         {Tag: "service", Summary: "Browse this OpenAPI document", Response: "", ResponseType: "text/html"},
+
+	"POST /auth/login": {Tag: "auth", Summary: "Log in with email and password", Request: LoginRequest{}, Response: TokenPair{}},
+	"POST /auth/refresh": {Tag: "auth", Summary: "Exchange a refresh token for a new token pair",
+		Description: "Each refresh token works once; reusing one revokes its whole session.",
+		Request:     RefreshRequest{}, Response: TokenPair{}},
+	"POST /auth/logout": {Tag: "auth", Summary: "Revoke the access token, and the refresh token if given",
+		Description: "API keys cannot log out: revoke them with DELETE /api-keys/{id}.",
+		Request:     RefreshRequest{}, RequestOptional: true, Status: http.StatusNoContent},
+
+	"GET /users": {Tag: "users", Summary: "List users",
+		Description: "Keyset-paginated: follow the Link header's rel=\"next\" URL for the next page.",
+		Params:      userListParams, Response: []User{}},
+	"POST /users": {Tag: "users", Summary: "Register a user",
+		Description: "Send an Idempotency-Key header to make retries safe.",
+		Request:     CreateUserRequest{}, Status: http.StatusCreated, Response: User{}},
+	"GET /users/{id}": {Tag: "users", Summary: "Get a user", Params: []OpenAPIParam{userIDParam}, Response: User{}},
+	"PUT /users/{id}": {Tag: "users", Summary: "Replace a user's editable fields",
+		Description: "Send If-Match with the user's ETag to avoid overwriting someone else's change.",
+		Params:      []OpenAPIParam{userIDParam}, Request: UpdateUserRequest{}, Response: User{}},
+	"PATCH /users/{id}": {Tag: "users", Summary: "Update a user with a JSON Merge Patch (RFC 7396)",
+		Params: []OpenAPIParam{userIDParam}, Request: UpdateUserRequest{}, RequestType: mergePatchType, Response: User{}},
+	"DELETE /users/{id}": {Tag: "users", Summary: "Delete a user", Params: []OpenAPIParam{userIDParam}, Status: http.StatusNoContent},
+
+	"GET /api-keys":         {Tag: "api-keys", Summary: "List API keys", Response: []APIKey{}},
+	"POST /api-keys":        {Tag: "api-keys", Summary: "Mint an API key", Description: "The key acts for the user who mints it, within its scopes but without their roles. The full key is in this response only.", Request: CreateAPIKeyRequest{}, Status: http.StatusCreated, Response: CreatedAPIKey{}},
+	"GET /api-keys/{id}":    {Tag: "api-keys", Summary: "Get an API key", Params: []OpenAPIParam{apiKeyIDParam}, Response: APIKey{}},
+	"DELETE /api-keys/{id}": {Tag: "api-keys", Summary: "Revoke an API key", Params: []OpenAPIParam{apiKeyIDParam}, Status: http.StatusNoContent},
+}
+
+// OpenAPI builds the OpenAPI 3.1 document from the route table, each
+// route's AccessRule and routeDocs.
+// PHP equivalent: bin/console nelmio:apidoc:dump
+func (api *API) OpenAPI() map[string]interface{} {
+	b := &schemaBuilder{schemas: map[string]interface{}{"APIError": apiErrorSchema}}
+	paths := make(map[string]interface{})
+
+	for _, rt := range api.Routes() {
+		method, path, _ := strings.Cut(rt.Pattern, " ")
+		path = strings.TrimSuffix(path, "{$}")
+
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+		item[strings.ToLower(method)] = b.operation(rt, routeDocs[rt.Pattern], path)
+	}
+
+	problem := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"description": description,
+			"content": map[string]interface{}{
+				"application/problem+json": map[string]interface{}{"schema": schemaRef("APIError")},
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":       "User API",
+			"version":     apiVersion,
+			"description": "Users, authentication and API keys. Every error is an RFC 7807 problem.",
+		},
+		"paths": paths,
+		// Routes without their own security accept either credential
+		"security": []interface{}{
+			map[string]interface{}{"bearerAuth": []string{}},
+			map[string]interface{}{"apiKey": []string{}},
+		},
+		"components": map[string]interface{}{
+			"schemas": b.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"apiKey":     map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+			"responses": map[string]interface{}{
+				"Unauthorized":    problem("Missing or invalid credentials"),
+				"Forbidden":       problem("Valid credentials without the required role, scope or ownership"),
+				"ValidationError": problem("The body failed validation; errors maps fields to messages"),
+				"TooManyRequests": problem("Rate limit exceeded; see Retry-After"),
+				"Error":           problem("Any other error"),
+			},
+		},
+	}
+}
+
+// apiErrorSchema describes Problem's JSON, which its MarshalJSON writes by hand.
+var apiErrorSchema = map[string]interface{}{
+	"type":        "object",
+	"description": "An RFC 7807 problem",
+	"required":    []string{"type", "title", "status"},
+	"properties": map[string]interface{}{
+		"type":       map[string]interface{}{"type": "string", "format": "uri-reference"},
+		"title":      map[string]interface{}{"type": "string"},
+		"status":     map[string]interface{}{"type": "integer"},
+		"detail":     map[string]interface{}{"type": "string"},
+		"instance":   map[string]interface{}{"type": "string", "format": "uri-reference"},
+		"code":       map[string]interface{}{"type": "string", "description": "Machine-readable error code, e.g. VALIDATION_ERROR"},
+		"errors":     map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}, "description": "Field to message, for validation failures"},
+		"request_id": map[string]interface{}{"type": "string", "description": "Quote this when reporting a problem"},
+	},
+}
+
+// pathParamPattern finds {name} wildcards, including {name...}.
+var pathParamPattern = regexp.MustCompile(`\{(\w+)(?:\.\.\.)?\}`)
+
+func (b *schemaBuilder) operation(rt Route, doc RouteDoc, path string) map[string]interface{} {
+	op := map[string]interface{}{"operationId": handlerName(rt.Handler)}
+	if doc.Summary != "" {
+		op["summary"] = doc.Summary
+	}
+	if doc.Tag != "" {
+		op["tags"] = []string{doc.Tag}
+	}
+	if description := accessDescription(rt.Access, doc.Description); description != "" {
+		op["description"] = description
+	}
+
+	var params []interface{}
+	for _, m := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+		p := OpenAPIParam{Name: m[1], In: "path", Schema: map[string]interface{}{"type": "string"}}
+		for _, dp := range doc.Params {
+			if dp.In == "path" && dp.Name == p.Name {
+				p = dp
+			}
+		}
+		params = append(params, openAPIParam(p, true))
+	}
+	for _, p := range doc.Params {
+		if p.In != "path" {
+			params = append(params, openAPIParam(p, false))
+		}
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	if doc.Request != nil {
+		schema := b.schema(reflect.TypeOf(doc.Request))
+		if doc.RequestType == mergePatchType {
+			schema = b.partial(schema)
+		}
+		op["requestBody"] = map[string]interface{}{
+			"required": !doc.RequestOptional,
+			"content": map[string]interface{}{
+				mediaTypeOr(doc.RequestType): map[string]interface{}{"schema": schema},
+			},
+		}
+	}
+
+	status := doc.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	if doc.Response != nil {
+		success["content"] = map[string]interface{}{
+			mediaTypeOr(doc.ResponseType): map[string]interface{}{"schema": b.schema(reflect.TypeOf(doc.Response))},
+		}
+	}
+	responses := map[string]interface{}{
+		strconv.Itoa(status): success,
+		"429":                responseRef("TooManyRequests"),
+		"default":            responseRef("Error"),
+	}
+	if doc.Request != nil {
+		responses["422"] = responseRef("ValidationError")
+	}
+	if !rt.Access.Public {
+		responses["401"] = responseRef("Unauthorized")
+		responses["403"] = responseRef("Forbidden")
+	}
+	op["responses"] = responses
+
+	switch {
+	case rt.Access.Public:
+		op["security"] = []interface{}{}
+	case len(rt.Access.Roles) > 0:
+		// API keys carry no roles
+		op["security"] = []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+	}
+	return op
+}
+
+// accessDescription spells out an AccessRule, which OpenAPI has no words for.
+func accessDescription(rule AccessRule, description string) string {
+	var lines []string
+	if description != "" {
+		lines = append(lines, description)
+	}
+	if len(rule.Roles) > 0 {
+		lines = append(lines, "Requires one of the roles: "+strings.Join(rule.Roles, ", ")+".")
+	}
+	if len(rule.Scopes) > 0 {
+		lines = append(lines, "Requires the scopes: "+strings.Join(rule.Scopes, ", ")+".")
+	}
+	if rule.Owner != "" {
+		lines = append(lines, "Only the owner of the resource, or an admin, may call it.")
+	}
+	return strings.Join(lines, "\n\n")
+}
+
+func openAPIParam(p OpenAPIParam, required bool) map[string]interface{} {
+	param := map[string]interface{}{"name": p.Name, "in": p.In, "schema": p.Schema}
+	if required {
+		param["required"] = true
+	}
+	if p.Description != "" {
+		param["description"] = p.Description
+	}
+	return param
+}
+
+// handlerName turns a method value such as api.ListUsers into "ListUsers".
+func handlerName(h http.HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+func mediaTypeOr(mediaType string) string {
+	if mediaType == "" {
+		return "application/json"
+	}
+	return mediaType
+}
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func responseRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/responses/" + name}
+}
+
+// schemaBuilder derives JSON Schemas from Go types, collecting named
+// structs under components/schemas.
+type schemaBuilder struct {
+	schemas map[string]interface{}
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(b.schema(t.Elem()))
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		if _, ok := b.schemas[t.Name()]; !ok {
+			b.schemas[t.Name()] = nil // Reserved, in case the type refers to itself
+			b.schemas[t.Name()] = b.object(t)
+		}
+		return schemaRef(t.Name())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	default:
+		return map[string]interface{}{} // Any value
+	}
+}
+
+// partial inlines a copy of an object schema without its required list:
+// a merge patch sends only the fields it changes.
+func (b *schemaBuilder) partial(schema map[string]interface{}) map[string]interface{} {
+	if ref, ok := schema["$ref"].(string); ok {
+		schema = b.schemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]interface{})
+	}
+	out := make(map[string]interface{}, len(schema))
+	for k, v := range schema {
+		if k != "required" {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// object describes a struct's fields. Structs with validate tags are
+// request bodies: a field is required if validate says so, and unknown
+// fields are rejected as httpx.DecodeJSON does. Other structs are responses,
+// which always include the fields without omitempty.
+func (b *schemaBuilder) object(t reflect.Type) map[string]interface{} {
+	input := hasValidateTags(t)
+	properties := make(map[string]interface{})
+	var required []string
+	b.fields(t, input, properties, &required)
+
+	s := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	if input {
+		s["additionalProperties"] = false
+	}
+	return s
+}
+
+func (b *schemaBuilder) fields(t reflect.Type, input bool, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		// Embedded structs are flattened, as encoding/json does
+		if f.Anonymous && f.Tag.Get("json") == "" && f.Type.Kind() == reflect.Struct {
+			b.fields(f.Type, input, properties, required)
+			continue
+		}
+		name := jsonName(f)
+		if name == "-" {
+			continue
+		}
+
+		s := b.schema(f.Type)
+		rules := parseTag(f.Tag.Get("validate"))
+		for j, r := range rules {
+			if r.name == "dive" {
+				if items, ok := s["items"].(map[string]interface{}); ok {
+					for _, ir := range rules[j+1:] {
+						applyRule(items, ir)
+					}
+				}
+				break
+			}
+			applyRule(s, r)
+		}
+		properties[name] = s
+
+		_, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch {
+		case input && containsRule(rules, "required"):
+			*required = append(*required, name)
+		case !input && !strings.Contains(opts, "omitempty"):
+			*required = append(*required, name)
+		}
+	}
+}
+
+// applyRule adds the JSON Schema keywords matching a validate rule.
+func applyRule(s map[string]interface{}, r rule) {
+	n, _ := strconv.Atoi(r.param)
+	switch r.name {
+	case "min", "max":
+		keyword := map[string]string{"string": "Length", "array": "Items"}[typeOf(s)]
+		if keyword == "" {
+			s[map[string]string{"min": "minimum", "max": "maximum"}[r.name]] = n
+		} else {
+			s[r.name+keyword] = n
+		}
+	case "required":
+		if typeOf(s) == "string" {
+			s["minLength"] = 1
+		}
+	case "email":
+		s["format"] = "email"
+	case "url":
+		s["format"] = "uri"
+	case "oneof":
+		s["enum"] = strings.Fields(r.param)
+	case "regex":
+		s["pattern"] = r.param
+	}
+}
+
+// typeOf returns a schema's type, ignoring "null".
+func typeOf(s map[string]interface{}) string {
+	switch t := s["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		return t[0].(string)
+	}
+	return ""
+}
+
+// nullable allows null as well as what s allows.
+func nullable(s map[string]interface{}) map[string]interface{} {
+	if _, ok := s["type"]; !ok {
+		return map[string]interface{}{"anyOf": []interface{}{s, map[string]interface{}{"type": "null"}}}
+	}
+	n := make(map[string]interface{}, len(s))
+	for k, v := range s {
+		n[k] = v
+	}
+	n["type"] = []interface{}{s["type"], "null"}
+	return n
+}
+
+func hasValidateTags(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("validate") != "" {
+			return true
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && hasValidateTags(f.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsRule(rules []rule, name string) bool {
+	for _, r := range rules {
+		if r.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenAPISpec serves the OpenAPI document.
+// PHP equivalent: NelmioApiDocBundle's /api/doc.json route
+func (api *API) OpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	body, err := json.Marshal(api.OpenAPI())
+	if err != nil {
+		writeErrorFor(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+//go:embed openapi.html
+var openAPIPage []byte
+
+// Docs serves a self-contained page that renders /openapi.json, in the
+// spirit of Swagger UI but without its assets or a CDN.
+// PHP equivalent: NelmioApiDocBundle's /api/doc route
+func (api *API) Docs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(openAPIPage)
+}
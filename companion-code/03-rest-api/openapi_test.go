@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/openapi.json")
+
+// goldenSpec is the committed OpenAPI document clients can rely on.
+const goldenSpec = "testdata/openapi.json"
+
+// TestOpenAPIUpToDate fails when a change to the routes or DTOs alters the
+// document, so the change has to be reviewed in testdata/openapi.json.
+// Accept it with: go test -run TestOpenAPIUpToDate -update
+func TestOpenAPIUpToDate(t *testing.T) {
+	got, err := json.MarshalIndent(NewAPI(nil, nil, nil, nil).OpenAPI(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+
+	if *update {
+		if err := os.WriteFile(goldenSpec, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(goldenSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("the OpenAPI document has drifted from %s; review the change and run go test -run TestOpenAPIUpToDate -update", goldenSpec)
+	}
+}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	routes := make(map[string]bool)
+	for _, rt := range NewAPI(nil, nil, nil, nil).Routes() {
+		routes[rt.Pattern] = true
+		doc, ok := routeDocs[rt.Pattern]
+		if !ok || doc.Summary == "" {
+			t.Errorf("%s has no RouteDoc with a summary", rt.Pattern)
+		}
+		// Every wildcard is documented, not left as a bare string
+		for _, m := range pathParamPattern.FindAllStringSubmatch(rt.Pattern, -1) {
+			documented := false
+			for _, p := range doc.Params {
+				documented = documented || (p.In == "path" && p.Name == m[1])
+			}
+			if !documented {
+				t.Errorf("%s does not document the {%s} path parameter", rt.Pattern, m[1])
+			}
+		}
+	}
+	for pattern := range routeDocs {
+		if !routes[pattern] {
+			t.Errorf("RouteDoc for %s, which is not a route", pattern)
+		}
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	spec := NewAPI(nil, nil, nil, nil).OpenAPI()
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	// Every $ref points at something
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				parts := strings.Split(strings.TrimPrefix(ref, "#/"), "/")
+				var target interface{} = spec
+				for _, p := range parts {
+					target = target.(map[string]interface{})[p]
+				}
+				if target == nil {
+					t.Errorf("dangling $ref %s", ref)
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(spec)
+
+	tests := []struct {
+		schema   string
+		required []string
+		property string
+		want     map[string]interface{}
+	}{
+		// Request bodies: required and constraints come from validate tags
+		{"CreateUserRequest", []string{"name", "email", "password"}, "password", map[string]interface{}{"type": "string", "minLength": 8}},
+		{"CreateUserRequest", nil, "email", map[string]interface{}{"type": "string", "minLength": 1, "format": "email"}},
+		{"CreateAPIKeyRequest", []string{"name", "scopes"}, "expires_at", map[string]interface{}{"type": []interface{}{"string", "null"}, "format": "date-time"}},
+		// Responses: fields without omitempty are always present
+		{"User", []string{"id", "name", "email", "roles", "created_at", "updated_at"}, "id", map[string]interface{}{"type": "integer", "format": "int64"}},
+	}
+	for _, tt := range tests {
+		s, ok := schemas[tt.schema].(map[string]interface{})
+		if !ok {
+			t.Errorf("no schema %s", tt.schema)
+			continue
+		}
+		if tt.required != nil && !reflect.DeepEqual(s["required"], tt.required) {
+			t.Errorf("%s required = %v, want %v", tt.schema, s["required"], tt.required)
+		}
+		if got := s["properties"].(map[string]interface{})[tt.property]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s.%s = %v, want %v", tt.schema, tt.property, got, tt.want)
+		}
+	}
+
+	if _, leaked := schemas["User"].(map[string]interface{})["properties"].(map[string]interface{})["Password"]; leaked {
+		t.Error("User schema documents the password hash")
+	}
+	// A merge patch may leave out any field
+	patch := spec["paths"].(map[string]interface{})["/users/{id}"].(map[string]interface{})["patch"].(map[string]interface{})
+	body := patch["requestBody"].(map[string]interface{})["content"].(map[string]interface{})[mergePatchType].(map[string]interface{})["schema"].(map[string]interface{})
+	if _, ok := body["required"]; ok || body["properties"] == nil {
+		t.Errorf("PATCH /users/{id} body = %v, want UpdateUserRequest without required", body)
+	}
+
+	scopes := schemas["CreateAPIKeyRequest"].(map[string]interface{})["properties"].(map[string]interface{})["scopes"].(map[string]interface{})
+	if items := scopes["items"].(map[string]interface{}); !reflect.DeepEqual(items["enum"], []string{ScopeUsersRead, ScopeUsersWrite}) {
+		t.Errorf("scopes items = %v, want the allowed scopes", items)
+	}
+}
+
+func TestOpenAPIEndpoints(t *testing.T) {
+	h := newAuthServer(t)
+
+	rec := doJSON(t, h, http.MethodGet, "/openapi.json", "", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /openapi.json = %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var spec struct {
+		OpenAPI string                            `json:"openapi"`
+		Paths   map[string]map[string]interface{} `json:"paths"`
+	}
+	decodeBody(t, rec, &spec)
+	if spec.OpenAPI != "3.1.0" || spec.Paths["/users/{id}"]["patch"] == nil {
+		t.Errorf("document = %+v", spec)
+	}
+
+	rec = doJSON(t, h, http.MethodGet, "/docs", "", "")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") ||
+		!strings.Contains(rec.Body.String(), `fetch("/openapi.json")`) {
+		t.Errorf("GET /docs = %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestListUsersLinks(t *testing.T) {
+	store := NewUserStore()
+	seedListUsers(t, store)
+	api := NewAPI(store, nil, nil, nil)
+	nextLink := regexp.MustCompile(`<([^>]+)>; rel="next"`)
+
+	var names []string
+	path := "/users?limit=2&sort=name&order=desc&email_domain=example.com"
+	for path != "" {
+		rec := httptest.NewRecorder()
+		api.ListUsers(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d: %s", path, rec.Code, rec.Body)
+		}
+
+		var users []User
+		decodeBody(t, rec, &users)
+		for _, u := range users {
+			names = append(names, u.Name)
+		}
+
+		path = ""
+		if m := nextLink.FindStringSubmatch(rec.Header().Get("Link")); m != nil {
+			path = m[1]
+		}
+	}
+
+	if want := []string{"Carol", "Bob"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+
+	rec := httptest.NewRecorder()
+	api.ListUsers(rec, httptest.NewRequest(http.MethodGet, "/users?sort=password", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("bad sort: status = %d, want 400", rec.Code)
+	}
+}
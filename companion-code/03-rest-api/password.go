@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnsupportedHash is returned for stored hashes in an unknown format.
+var ErrUnsupportedHash = errors.New("unsupported password hash format")
+
+// Argon2Params are the argon2id cost settings.
+// PHP equivalent: the options array of password_hash($p, PASSWORD_ARGON2ID, [...])
+type Argon2Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params matches PHP's PASSWORD_ARGON2ID defaults
+// (memory_cost 65536, time_cost 4, threads 1), so either app can verify
+// the other's hashes without either one asking for a rehash.
+func DefaultArgon2Params() Argon2Params {
+	return Argon2Params{Memory: 64 * 1024, Iterations: 4, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+}
+
+// PasswordHasher hashes new passwords with argon2id and verifies both argon2id
+// and the bcrypt hashes the PHP app wrote with password_hash().
+// PHP equivalent: UserPasswordHasherInterface with the "auto" algorithm
+type PasswordHasher struct {
+	params Argon2Params
+	dummy  string // Verified against for unknown users to keep timing uniform
+}
+
+func NewPasswordHasher(params Argon2Params) (*PasswordHasher, error) {
+	h := &PasswordHasher{params: params}
+	dummy, err := h.Hash("dummy password")
+	if err != nil {
+		return nil, err
+	}
+	h.dummy = dummy
+	return h, nil
+}
+
+// Hash returns an argon2id hash in the PHC string format PHP uses:
+// $argon2id$v=19$m=65536,t=4,p=1$<salt>$<hash>
+// PHP equivalent: password_hash($password, PASSWORD_ARGON2ID)
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := h.params
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify reports whether password matches the stored hash.
+// A mismatch is (false, nil); an error means the hash itself is unusable.
+// PHP equivalent: password_verify($password, $hash)
+func (h *PasswordHasher) Verify(password, hash string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+
+	case isBcrypt(hash):
+		// PHP writes $2y$; it is the same algorithm as $2a$/$2b$
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	return false, ErrUnsupportedHash
+}
+
+// NeedsRehash reports whether hash should be replaced by a fresh Hash():
+// bcrypt hashes are migrated to argon2id, and argon2id hashes made with
+// different parameters are brought up to date.
+// PHP equivalent: password_needs_rehash($hash, PASSWORD_ARGON2ID)
+func (h *PasswordHasher) NeedsRehash(hash string) bool {
+	params, _, _, err := decodeArgon2id(hash)
+	return err != nil || params != h.params
+}
+
+// decodeArgon2id parses a PHC-format argon2id hash.
+func decodeArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2Params{}, nil, nil, ErrUnsupportedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, ErrUnsupportedHash
+	}
+
+	var p Argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return Argon2Params{}, nil, nil, ErrUnsupportedHash
+	}
+	// argon2.IDKey panics on zero iterations or parallelism, and zero
+	// memory is no hash worth accepting
+	if p.Memory == 0 || p.Iterations == 0 || p.Parallelism == 0 {
+		return Argon2Params{}, nil, nil, ErrUnsupportedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrUnsupportedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2Params{}, nil, nil, ErrUnsupportedHash
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
+
+func isBcrypt(hash string) bool {
+	for _, prefix := range []string{"$2y$", "$2a$", "$2b$"} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testParams keep argon2id cheap enough for tests.
+var testParams = Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func newTestHasher(t *testing.T) *PasswordHasher {
+	t.Helper()
+	h, err := NewPasswordHasher(testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// phpBcrypt returns a bcrypt hash with PHP's $2y$ prefix, as password_hash() writes it.
+func phpBcrypt(t *testing.T, password string) string {
+	t.Helper()
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "$2y$" + strings.TrimPrefix(string(b), "$2a$")
+}
+
+func TestPasswordHasher(t *testing.T) {
+	h := newTestHasher(t)
+
+	hash, err := h.Hash("s3cret-pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("hash = %q, want PHC argon2id format", hash)
+	}
+	if other, _ := h.Hash("s3cret-pass"); other == hash {
+		t.Error("two hashes of the same password are identical; salt not random")
+	}
+
+	// Parameters are read from the hash, so raising the cost keeps old hashes valid
+	old, err := NewPasswordHasher(Argon2Params{Memory: 512, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldHash, err := old.Hash("s3cret-pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		hash     string
+		want     bool
+		rehash   bool
+	}{
+		{"argon2id match", "s3cret-pass", hash, true, false},
+		{"argon2id mismatch", "wrong", hash, false, false},
+		{"PHP bcrypt match", "legacy-pass", phpBcrypt(t, "legacy-pass"), true, true},
+		{"PHP bcrypt mismatch", "wrong", phpBcrypt(t, "legacy-pass"), false, true},
+		{"argon2id with old parameters", "s3cret-pass", oldHash, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.Verify(tt.password, tt.hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Verify = %v, want %v", got, tt.want)
+			}
+			if rehash := h.NeedsRehash(tt.hash); rehash != tt.rehash {
+				t.Errorf("NeedsRehash = %v, want %v", rehash, tt.rehash)
+			}
+		})
+	}
+
+	if _, err := h.Verify("x", "plaintext"); err != ErrUnsupportedHash {
+		t.Errorf("plaintext hash: err = %v, want ErrUnsupportedHash", err)
+	}
+}
+
+// TestVerifyRejectsZeroArgon2Params tests that a stored hash with a zero
+// cost parameter is refused rather than handed to argon2.IDKey.
+func TestVerifyRejectsZeroArgon2Params(t *testing.T) {
+	h := newTestHasher(t)
+	hash, err := h.Hash("s3cret-pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, params := range []string{"m=0,t=1,p=1", "m=1024,t=0,p=1", "m=1024,t=1,p=0"} {
+		t.Run(params, func(t *testing.T) {
+			bad := strings.Replace(hash, "m=1024,t=1,p=1", params, 1)
+			if _, err := h.Verify("s3cret-pass", bad); err != ErrUnsupportedHash {
+				t.Errorf("Verify: err = %v, want ErrUnsupportedHash", err)
+			}
+			if !h.NeedsRehash(bad) {
+				t.Error("NeedsRehash = false, want true")
+			}
+		})
+	}
+}
+
+func TestLoginRehashesLegacyPassword(t *testing.T) {
+	cfg := JWTConfig{Secret: testSecret, AccessTTL: time.Minute, RefreshTTL: time.Hour, Denylist: NewMemoryDenylist()}
+	users := NewUserStore()
+	tokens, err := NewTokenService(cfg, users, NewMemoryRefreshStore(), cfg.Denylist)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &User{Name: "Bob", Email: "bob@example.com", Password: phpBcrypt(t, "from-symfony")}
+	if err := users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	api := NewAPI(users, tokens, newTestHasher(t), NewAPIKeyStore())
+
+	rec := doJSON(t, http.HandlerFunc(api.Login), http.MethodPost, "/auth/login", "", `{"email":"bob@example.com","password":"from-symfony"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	stored, err := users.FindByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upgraded := stored.Password
+	if !strings.HasPrefix(upgraded, "$argon2id$") {
+		t.Fatalf("password not rehashed: %q", upgraded)
+	}
+	if ok, _ := api.passwords.Verify("from-symfony", upgraded); !ok {
+		t.Error("rehashed password does not verify")
+	}
+}
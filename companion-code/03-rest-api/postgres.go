@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/pgerr"
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/userlist"
+	"github.com/lib/pq"
+)
+
+//go:embed migrations/001_create_users.sql
+var postgresSchema string
+
+// PostgresUserRepository is a UserRepository backed by PostgreSQL, built
+// like the database example's UserRepository: plain SQL over database/sql.
+// Read-modify-write operations lock the row (SELECT ... FOR UPDATE) so
+// they are as atomic as UserStore's mutex makes them in memory.
+// PHP equivalent: App\Repository\UserRepository extends ServiceEntityRepository
+type PostgresUserRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresUserRepository(db *sql.DB) *PostgresUserRepository {
+	return &PostgresUserRepository{db: db}
+}
+
+// Migrate creates the schema if it does not exist yet.
+// PHP equivalent: bin/console doctrine:migrations:migrate
+func (r *PostgresUserRepository) Migrate(ctx context.Context) error {
+	if _, err := r.db.ExecContext(ctx, postgresSchema); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	return nil
+}
+
+const userColumns = `id, name, email, password, roles, created_at, updated_at`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row rowScanner) (*User, error) {
+	var u User
+	err := row.Scan(&u.ID, &u.Name, &u.Email, &u.Password, pq.Array(&u.Roles), &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	u.CreatedAt = u.CreatedAt.UTC()
+	u.UpdatedAt = u.UpdatedAt.UTC()
+	return &u, nil
+}
+
+// dbTime rounds t to what PostgreSQL stores, so the user returned from a
+// write has the same timestamps, and ETag, as the one read back later.
+func dbTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// Create inserts a new user.
+// PHP equivalent: $em->persist($user); $em->flush();
+func (r *PostgresUserRepository) Create(ctx context.Context, user *User) error {
+	now := dbTime(time.Now())
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	user.CreatedAt = dbTime(user.CreatedAt)
+	user.UpdatedAt = now
+
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO users (name, email, password, roles, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id
+		`, user.Name, user.Email, user.Password, pq.Array(nonNilRoles(user.Roles)), user.CreatedAt, user.UpdatedAt).Scan(&user.ID)
+		if pgerr.IsUniqueViolation(err) {
+			return fmt.Errorf("email %s: %w", user.Email, ErrConflict)
+		}
+		if err != nil {
+			return fmt.Errorf("insert user: %w", err)
+		}
+		return touchUsers(ctx, tx, now)
+	})
+}
+
+func (r *PostgresUserRepository) FindByID(ctx context.Context, id int64) (*User, error) {
+	u, err := scanUser(r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find user %d: %w", id, err)
+	}
+	return u, nil
+}
+
+// FindByEmail ignores case, using the lower(email) index.
+// PHP equivalent: $repository->findOneBy(['email' => $email])
+func (r *PostgresUserRepository) FindByEmail(ctx context.Context, email string) (*User, error) {
+	u, err := scanUser(r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE lower(email) = lower($1)`, email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %s: %w", email, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find user by email: %w", err)
+	}
+	return u, nil
+}
+
+// List runs the keyset query for q.
+func (r *PostgresUserRepository) List(ctx context.Context, q userlist.Query) ([]*User, *userlist.Cursor, error) {
+	query, args := q.SQL(userColumns)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, nil, fmt.Errorf("scan user: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("list users: %w", err)
+	}
+
+	// The extra row only tells us there is another page
+	if len(users) <= q.Limit {
+		return users, nil, nil
+	}
+	users = users[:q.Limit]
+	last := users[len(users)-1]
+	return users, q.CursorAfter(last.ID, last.Name, last.Email, last.CreatedAt), nil
+}
+
+// Update locks the row, applies fn and writes the result back.
+// PHP equivalent: $em->lock($user, LockMode::PESSIMISTIC_WRITE) in a transaction
+func (r *PostgresUserRepository) Update(ctx context.Context, id int64, fn func(*User) error) (*User, error) {
+	var updated *User
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := lockUser(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		u := *current
+		if err := fn(&u); err != nil {
+			return err
+		}
+		u.ID = current.ID
+		u.CreatedAt = current.CreatedAt
+		u.UpdatedAt = dbTime(time.Now())
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE users
+			SET name = $1, email = $2, password = $3, roles = $4, updated_at = $5
+			WHERE id = $6
+		`, u.Name, u.Email, u.Password, pq.Array(nonNilRoles(u.Roles)), u.UpdatedAt, u.ID)
+		if pgerr.IsUniqueViolation(err) {
+			return fmt.Errorf("email %s: %w", u.Email, ErrConflict)
+		}
+		if err != nil {
+			return fmt.Errorf("update user %d: %w", id, err)
+		}
+
+		updated = &u
+		return touchUsers(ctx, tx, u.UpdatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// Delete locks the row, runs check and deletes it.
+// PHP equivalent: $em->remove($user); $em->flush();
+func (r *PostgresUserRepository) Delete(ctx context.Context, id int64, check func(*User) error) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := lockUser(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if check != nil {
+			if err := check(current); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id); err != nil {
+			return fmt.Errorf("delete user %d: %w", id, err)
+		}
+		return touchUsers(ctx, tx, dbTime(time.Now()))
+	})
+}
+
+func (r *PostgresUserRepository) LastModified(ctx context.Context) (time.Time, error) {
+	var t time.Time
+	if err := r.db.QueryRowContext(ctx, `SELECT modified_at FROM users_modified`).Scan(&t); err != nil {
+		return time.Time{}, fmt.Errorf("users last modified: %w", err)
+	}
+	return t.UTC(), nil
+}
+
+// withTx runs fn in a transaction, committing only if it returns nil.
+// PHP equivalent: $em->wrapInTransaction(function() { ... })
+func (r *PostgresUserRepository) withTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("rollback failed: %v (original: %w)", rbErr, err)
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
+	}
+	return nil
+}
+
+// lockUser reads a user and locks the row until the transaction ends.
+func lockUser(ctx context.Context, tx *sql.Tx, id int64) (*User, error) {
+	u, err := scanUser(tx.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1 FOR UPDATE`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock user %d: %w", id, err)
+	}
+	return u, nil
+}
+
+// touchUsers records a change to the table for LastModified. The row lock
+// it takes also orders concurrent writers, which is fine at this scale.
+func touchUsers(ctx context.Context, tx *sql.Tx, at time.Time) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE users_modified SET modified_at = $1`, at); err != nil {
+		return fmt.Errorf("touch users: %w", err)
+	}
+	return nil
+}
+
+// nonNilRoles stores "no roles" as an empty array; the column is NOT NULL.
+func nonNilRoles(roles []string) []string {
+	if roles == nil {
+		return []string{}
+	}
+	return roles
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/pgerr"
+	"github.com/lib/pq"
+)
+
+//go:embed migrations/002_create_api_keys.sql
+var apiKeySchema string
+
+// PostgresAPIKeyRepository is an APIKeyRepository backed by PostgreSQL,
+// in the same database as PostgresUserRepository: deleting a user deletes
+// their keys. Migrate it after the users.
+// PHP equivalent: App\Repository\ApiTokenRepository extends ServiceEntityRepository
+type PostgresAPIKeyRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresAPIKeyRepository(db *sql.DB) *PostgresAPIKeyRepository {
+	return &PostgresAPIKeyRepository{db: db}
+}
+
+// Migrate creates the schema if it does not exist yet.
+func (r *PostgresAPIKeyRepository) Migrate(ctx context.Context) error {
+	if _, err := r.db.ExecContext(ctx, apiKeySchema); err != nil {
+		return fmt.Errorf("migrate api_keys: %w", err)
+	}
+	return nil
+}
+
+const apiKeyColumns = `id, name, hash, scopes, owner_id, created_at, expires_at, last_used_at`
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var k APIKey
+	var expiresAt, lastUsedAt sql.NullTime
+	err := row.Scan(&k.ID, &k.Name, &k.Hash, pq.Array(&k.Scopes), &k.OwnerID, &k.CreatedAt, &expiresAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	k.CreatedAt = k.CreatedAt.UTC()
+	if expiresAt.Valid {
+		t := expiresAt.Time.UTC()
+		k.ExpiresAt = &t
+	}
+	if lastUsedAt.Valid {
+		t := lastUsedAt.Time.UTC()
+		k.LastUsedAt = &t
+	}
+	return &k, nil
+}
+
+// Create inserts a key. Unlike an upsert, a duplicate ID is an error.
+func (r *PostgresAPIKeyRepository) Create(ctx context.Context, key *APIKey) error {
+	key.CreatedAt = dbTime(key.CreatedAt)
+	if key.ExpiresAt != nil {
+		t := dbTime(*key.ExpiresAt)
+		key.ExpiresAt = &t
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO api_keys (id, name, hash, scopes, owner_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, key.ID, key.Name, key.Hash, pq.Array(key.Scopes), key.OwnerID, key.CreatedAt, key.ExpiresAt)
+	if pgerr.IsUniqueViolation(err) {
+		return fmt.Errorf("API key %s: %w", key.ID, ErrConflict)
+	}
+	if err != nil {
+		return fmt.Errorf("insert API key: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresAPIKeyRepository) FindByID(ctx context.Context, id string) (*APIKey, error) {
+	k, err := scanAPIKey(r.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("API key %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find API key %s: %w", id, err)
+	}
+	return k, nil
+}
+
+func (r *PostgresAPIKeyRepository) List(ctx context.Context) ([]APIKey, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_at DESC, id`)
+	if err != nil {
+		return nil, fmt.Errorf("list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan API key: %w", err)
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+func (r *PostgresAPIKeyRepository) MarkUsed(ctx context.Context, id string, at time.Time) error {
+	return r.exec(ctx, id, `UPDATE api_keys SET last_used_at = $2 WHERE id = $1`, dbTime(at))
+}
+
+func (r *PostgresAPIKeyRepository) Delete(ctx context.Context, id string) error {
+	return r.exec(ctx, id, `DELETE FROM api_keys WHERE id = $1`)
+}
+
+// exec runs a statement on the key with the given ID, returning ErrNotFound
+// if there is none.
+func (r *PostgresAPIKeyRepository) exec(ctx context.Context, id, query string, args ...interface{}) error {
+	result, err := r.db.ExecContext(ctx, query, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return fmt.Errorf("API key %s: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("API key %s: %w", id, err)
+	} else if n == 0 {
+		return fmt.Errorf("API key %s: %w", id, ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/httpx"
+)
+
+func TestWriteErrorFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{"not found", fmt.Errorf("user 7: %w", ErrNotFound), http.StatusNotFound, "NOT_FOUND", "Resource not found"},
+		{"conflict", fmt.Errorf("email bob@example.com: %w", ErrConflict), http.StatusConflict, "CONFLICT", "Resource already exists"},
+		{"stale write", httpx.ErrPreconditionFailed, http.StatusPreconditionFailed, "PRECONDITION_FAILED", "The resource was modified; fetch it again"},
+		{"validation", ValidationErrors{"email": "Invalid email format"}, http.StatusUnprocessableEntity, "VALIDATION_ERROR", "Validation failed"},
+		{"unauthorised hides the reason", ErrTokenExpired, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required"},
+		{"unknown hides the error", errors.New("connection refused"), http.StatusInternalServerError, "INTERNAL_ERROR", "An unexpected error occurred"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/7", nil)
+			rec := httptest.NewRecorder()
+			rec.Header().Set("X-Request-ID", "req-1")
+
+			writeErrorFor(rec, req, tt.err)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want application/problem+json", ct)
+			}
+
+			var p APIError
+			if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Type != "about:blank" || p.Title != http.StatusText(tt.status) || p.Status != tt.status || p.Instance != "/users/7" {
+				t.Errorf("standard members = %+v", p)
+			}
+			if p.Detail != tt.detail {
+				t.Errorf("detail = %q, want %q", p.Detail, tt.detail)
+			}
+			if p.Extensions["code"] != tt.code || p.Extensions["request_id"] != "req-1" {
+				t.Errorf("extensions = %v", p.Extensions)
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimit is a token bucket: it holds up to Limit requests and refills
+// completely over Period, so a client may burst Limit requests and then
+// sustain Limit per Period.
+// PHP equivalent: a 'token_bucket' policy in framework.rate_limiter
+type RateLimit struct {
+	Limit  int
+	Period time.Duration
+}
+
+// refill returns the tokens in a bucket after elapsed time, capped at Limit.
+func (l RateLimit) refill(tokens float64, elapsed time.Duration) float64 {
+	tokens += elapsed.Seconds() * float64(l.Limit) / l.Period.Seconds()
+	return math.Min(tokens, float64(l.Limit))
+}
+
+// until returns how long a bucket holding tokens takes to hold want.
+func (l RateLimit) until(tokens, want float64) time.Duration {
+	if tokens >= want {
+		return 0
+	}
+	return time.Duration((want - tokens) * float64(l.Period) / float64(l.Limit))
+}
+
+// RateLimitConfig sets a bucket per kind of caller. A zero Limit turns
+// limiting off for that kind.
+type RateLimitConfig struct {
+	// Anonymous requests share a bucket per client IP.
+	Anonymous RateLimit
+	// User requests share a bucket per token subject, whatever their IP.
+	User RateLimit
+	// APIKey requests share a bucket per key.
+	APIKey RateLimit
+	// PerIP is a ceiling on every request from one client IP, applied by
+	// IPRateLimitMiddleware before credentials are checked, so requests
+	// with bad tokens or keys are throttled too.
+	PerIP RateLimit
+	// TrustForwardedFor takes the client IP from X-Forwarded-For. Only set
+	// it behind a proxy that appends to the header, or clients can pick
+	// their own bucket.
+	TrustForwardedFor bool
+}
+
+// DefaultRateLimitConfig gives services more room than people, and people
+// more room than anonymous clients.
+func DefaultRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		Anonymous: RateLimit{Limit: 60, Period: time.Minute},
+		User:      RateLimit{Limit: 300, Period: time.Minute},
+		APIKey:    RateLimit{Limit: 1000, Period: time.Minute},
+		// Above APIKey so one service behind an IP is never held back by it
+		PerIP: RateLimit{Limit: 1200, Period: time.Minute},
+	}
+}
+
+// bucketFor picks the bucket key and limit for a request.
+func (c RateLimitConfig) bucketFor(r *http.Request) (string, RateLimit) {
+	claims, ok := ClaimsFromContext(r.Context())
+	switch {
+	case ok && claims.APIKeyID != "":
+		return "key:" + claims.APIKeyID, c.APIKey
+	case ok:
+		return "user:" + claims.Subject, c.User
+	default:
+		return "ip:" + clientIP(r, c.TrustForwardedFor), c.Anonymous
+	}
+}
+
+// clientIP returns the caller's address. IPv6 clients usually get a whole
+// /64, so they are grouped by that prefix rather than by address.
+func clientIP(r *http.Request, trustForwardedFor bool) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if forwarded := r.Header.Values("X-Forwarded-For"); trustForwardedFor && len(forwarded) > 0 {
+		// The last entry was added by our proxy; earlier ones are client-supplied
+		hops := strings.Split(forwarded[len(forwarded)-1], ",")
+		host = strings.TrimSpace(hops[len(hops)-1])
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+	if addr.Is6() {
+		prefix, _ := addr.Prefix(64)
+		return prefix.String()
+	}
+	return addr.String()
+}
+
+// RateLimitStore keeps token buckets. Take removes a token from key's
+// bucket if it holds one, and returns the tokens left either way.
+// PHP equivalent: Symfony\Component\RateLimiter\Storage\StorageInterface
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit RateLimit, now time.Time) (allowed bool, tokens float64, err error)
+}
+
+// RateLimitMiddleware applies cfg's token buckets, answering 429 once a
+// bucket is empty. Every limited response carries the RateLimit-* headers
+// from the IETF draft, so well-behaved clients can slow down before then.
+// It must run after AuthMiddleware and APIKeyMiddleware to see who is
+// calling; IPRateLimitMiddleware covers the requests those reject. If the
+// store fails, requests are let through: an outage of the limiter should
+// not become an outage of the API.
+// PHP equivalent: RateLimiterFactory::create($key)->consume() in a request listener
+func RateLimitMiddleware(store RateLimitStore, cfg RateLimitConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, limit := cfg.bucketFor(r)
+			if takeToken(w, r, store, key, limit) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// IPRateLimitMiddleware applies cfg.PerIP to every request. It must run
+// before AuthMiddleware and APIKeyMiddleware, which answer 401 without
+// reaching RateLimitMiddleware, so guessing credentials is throttled too.
+// PHP equivalent: the login_throttling option of a Symfony firewall
+func IPRateLimitMiddleware(store RateLimitStore, cfg RateLimitConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if takeToken(w, r, store, "any:"+clientIP(r, cfg.TrustForwardedFor), cfg.PerIP) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// takeToken takes a token from key's bucket and sets the RateLimit-*
+// headers. It returns false, having answered 429, when the bucket is empty.
+func takeToken(w http.ResponseWriter, r *http.Request, store RateLimitStore, key string, limit RateLimit) bool {
+	if limit.Limit <= 0 || limit.Period <= 0 {
+		return true
+	}
+
+	allowed, tokens, err := store.Take(r.Context(), key, limit, time.Now())
+	if err != nil {
+		logf(r.Context(), "Rate limit store failed, allowing request: %v", err)
+		return true
+	}
+
+	h := w.Header()
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Limit, ceilSeconds(limit.Period)))
+	h.Set("RateLimit-Limit", strconv.Itoa(limit.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(int(tokens)))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(limit.until(tokens, float64(limit.Limit)))))
+
+	if !allowed {
+		retry := ceilSeconds(limit.until(tokens, 1))
+		h.Set("Retry-After", strconv.Itoa(retry))
+		writeError(w, r, http.StatusTooManyRequests, "RATE_LIMITED",
+			fmt.Sprintf("Too many requests; retry in %d seconds", retry))
+		return false
+	}
+	return true
+}
+
+// ceilSeconds rounds d up to whole seconds, as the headers require.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// openRateLimitStore returns a Redis store when redisURL is set, so every
+// instance shares the buckets, and an in-memory store otherwise.
+func openRateLimitStore(redisURL string) (RateLimitStore, func() error, error) {
+	if redisURL == "" {
+		return NewMemoryRateLimitStore(), func() error { return nil }, nil
+	}
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse REDIS_URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	return NewRedisRateLimitStore(client), client.Close, nil
+}
+
+// --- In-memory store ---
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	period  time.Duration
+}
+
+// MemoryRateLimitStore is a RateLimitStore for a single instance.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket)}
+}
+
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, limit RateLimit, now time.Time) (bool, float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit.Limit), updated: now}
+		s.buckets[key] = b
+	} else if now.After(b.updated) {
+		b.tokens = limit.refill(b.tokens, now.Sub(b.updated))
+		b.updated = now
+	}
+	b.period = limit.Period
+
+	if b.tokens < 1 {
+		return false, b.tokens, nil
+	}
+	b.tokens--
+	return true, b.tokens, nil
+}
+
+// sweep drops buckets that have refilled, which are no different from
+// missing ones, to bound memory. It runs at most once a minute.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.swept) < time.Minute {
+		return
+	}
+	s.swept = now
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) >= b.period {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// --- Redis store ---
+
+// tokenBucketScript is MemoryRateLimitStore.Take as a Lua script, so the
+// read-refill-write is atomic however many instances share the bucket.
+// Buckets expire once they would be full again. Tokens are returned as a
+// string because Redis truncates Lua numbers to integers.
+var tokenBucketScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1])
+local updated = tonumber(state[2])
+if tokens == nil then
+  tokens = limit
+  updated = now
+elseif now > updated then
+  tokens = math.min(limit, tokens + (now - updated) * limit / period)
+  updated = now
+end
+
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', updated)
+redis.call('PEXPIRE', KEYS[1], period)
+return {allowed, tostring(tokens)}
+`)
+
+// RedisRateLimitStore is a RateLimitStore shared by every instance. It
+// needs only EVALSHA/EVAL, so Valkey, KeyDB and clusters work too.
+type RedisRateLimitStore struct {
+	client redis.Scripter
+	prefix string
+}
+
+func NewRedisRateLimitStore(client redis.Scripter) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: client, prefix: "ratelimit:"}
+}
+
+// Take uses the caller's clock, like the other stores. Keep instances in
+// sync with NTP; a clock running behind only delays refills.
+func (s *RedisRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, now time.Time) (bool, float64, error) {
+	res, err := tokenBucketScript.Run(ctx, s.client, []string{s.prefix + key},
+		limit.Limit, limit.Period.Milliseconds(), now.UnixMilli()).Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("rate limit %s: %w", key, err)
+	}
+	if len(res) != 2 {
+		return false, 0, fmt.Errorf("rate limit %s: unexpected reply %v", key, res)
+	}
+
+	allowed, _ := res[0].(int64)
+	tokensStr, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return false, 0, fmt.Errorf("rate limit %s: bad token count %q", key, tokensStr)
+	}
+	return allowed == 1, tokens, nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	testRateLimitStore(t, func(t *testing.T) RateLimitStore { return NewMemoryRateLimitStore() })
+}
+
+// TestRedisRateLimitStore runs the script against miniredis, an in-process
+// Redis that executes Lua.
+func TestRedisRateLimitStore(t *testing.T) {
+	testRateLimitStore(t, func(t *testing.T) RateLimitStore {
+		client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+		t.Cleanup(func() { client.Close() })
+		return NewRedisRateLimitStore(client)
+	})
+
+	t.Run("buckets expire once full", func(t *testing.T) {
+		m := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+		defer client.Close()
+
+		limit := RateLimit{Limit: 10, Period: time.Minute}
+		if _, _, err := NewRedisRateLimitStore(client).Take(context.Background(), "ip:192.0.2.1", limit, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		if ttl := m.TTL("ratelimit:ip:192.0.2.1"); ttl <= 0 || ttl > time.Minute {
+			t.Errorf("TTL = %v, want up to a minute", ttl)
+		}
+	})
+
+	t.Run("server down", func(t *testing.T) {
+		m := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: m.Addr(), MaxRetries: -1})
+		defer client.Close()
+		m.Close()
+
+		limit := RateLimit{Limit: 10, Period: time.Minute}
+		if _, _, err := NewRedisRateLimitStore(client).Take(context.Background(), "k", limit, time.Now()); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+// testRateLimitStore is the behaviour every RateLimitStore must share.
+func testRateLimitStore(t *testing.T, newStore func(t *testing.T) RateLimitStore) {
+	ctx := context.Background()
+	limit := RateLimit{Limit: 3, Period: 3 * time.Second} // A token a second
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	take := func(t *testing.T, store RateLimitStore, key string, at time.Duration) (bool, float64) {
+		t.Helper()
+		allowed, tokens, err := store.Take(ctx, key, limit, start.Add(at))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return allowed, tokens
+	}
+
+	t.Run("burst then refill", func(t *testing.T) {
+		store := newStore(t)
+		for i, want := range []float64{2, 1, 0} {
+			if allowed, tokens := take(t, store, "k", 0); !allowed || tokens != want {
+				t.Fatalf("request %d: allowed %t, tokens %v; want allowed with %v left", i+1, allowed, tokens, want)
+			}
+		}
+		if allowed, tokens := take(t, store, "k", 500*time.Millisecond); allowed || tokens != 0.5 {
+			t.Errorf("empty bucket: allowed %t, tokens %v; want refused with 0.5", allowed, tokens)
+		}
+		if allowed, tokens := take(t, store, "k", time.Second); !allowed || tokens != 0 {
+			t.Errorf("after a second: allowed %t, tokens %v; want allowed with 0 left", allowed, tokens)
+		}
+		// Never more than Limit, however long the wait
+		if allowed, tokens := take(t, store, "k", time.Hour); !allowed || tokens != 2 {
+			t.Errorf("after an hour: allowed %t, tokens %v; want allowed with 2 left", allowed, tokens)
+		}
+	})
+
+	t.Run("keys are independent", func(t *testing.T) {
+		store := newStore(t)
+		for i := 0; i < 3; i++ {
+			take(t, store, "a", 0)
+		}
+		if allowed, _ := take(t, store, "a", 0); allowed {
+			t.Error("a: fourth request allowed")
+		}
+		if allowed, tokens := take(t, store, "b", 0); !allowed || tokens != 2 {
+			t.Errorf("b: allowed %t, tokens %v", allowed, tokens)
+		}
+	})
+
+	t.Run("clock going backwards", func(t *testing.T) {
+		store := newStore(t)
+		take(t, store, "k", time.Second)
+		if allowed, tokens := take(t, store, "k", 0); !allowed || tokens != 1 {
+			t.Errorf("allowed %t, tokens %v; want no refill", allowed, tokens)
+		}
+	})
+}
+
+// failingRateLimitStore simulates the store being unreachable.
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(context.Context, string, RateLimit, time.Time) (bool, float64, error) {
+	return false, 0, errors.New("connection refused")
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	cfg := RateLimitConfig{
+		Anonymous: RateLimit{Limit: 2, Period: time.Minute},
+		User:      RateLimit{Limit: 5, Period: time.Minute},
+		APIKey:    RateLimit{Limit: 10, Period: time.Minute},
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	h := RateLimitMiddleware(NewMemoryRateLimitStore(), cfg)(ok)
+
+	get := func(remoteAddr string, claims *Claims) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.RemoteAddr = remoteAddr
+		if claims != nil {
+			req = req.WithContext(WithClaims(req.Context(), claims))
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := get("192.0.2.1:1234", nil); rec.Code != http.StatusNoContent {
+			t.Fatalf("request %d: status = %d", i+1, rec.Code)
+		}
+	}
+
+	rec := get("192.0.2.1:5678", nil)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("third request: status = %d, want 429", rec.Code)
+	}
+	wantHeaders := map[string]string{
+		"Retry-After":         "30",
+		"RateLimit-Policy":    "2;w=60",
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "0",
+	}
+	for name, want := range wantHeaders {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	var p APIError
+	decodeBody(t, rec, &p)
+	if p.Status != http.StatusTooManyRequests || p.Extensions["code"] != "RATE_LIMITED" {
+		t.Errorf("problem = %+v", p)
+	}
+
+	// Other callers from the same address have their own buckets
+	tests := []struct {
+		name   string
+		addr   string
+		claims *Claims
+		limit  string
+	}{
+		{"another IP", "192.0.2.2:1234", nil, "2"},
+		{"user", "192.0.2.1:1234", &Claims{Subject: "1"}, "5"},
+		{"API key", "192.0.2.1:1234", &Claims{Subject: "1", APIKeyID: "ak_1a2b3c4d"}, "10"},
+	}
+	for _, tt := range tests {
+		rec := get(tt.addr, tt.claims)
+		if rec.Code != http.StatusNoContent || rec.Header().Get("RateLimit-Limit") != tt.limit {
+			t.Errorf("%s: status = %d, RateLimit-Limit = %q", tt.name, rec.Code, rec.Header().Get("RateLimit-Limit"))
+		}
+	}
+
+	// A broken store lets requests through
+	rec = httptest.NewRecorder()
+	RateLimitMiddleware(failingRateLimitStore{}, cfg)(ok).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("failing store: status = %d, want 204", rec.Code)
+	}
+}
+
+func TestIPRateLimitMiddleware(t *testing.T) {
+	cfg := RateLimitConfig{PerIP: RateLimit{Limit: 2, Period: time.Minute}}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	// Bad keys are rejected inside the limit, before RateLimitMiddleware could see them
+	h := IPRateLimitMiddleware(NewMemoryRateLimitStore(), cfg)(APIKeyMiddleware(NewAPIKeyStore(), NewUserStore())(ok))
+
+	guess := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-API-Key", "ak_00000000.guess")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for i, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		if got := guess("192.0.2.1:1234"); got != want {
+			t.Fatalf("guess %d: status = %d, want %d", i+1, got, want)
+		}
+	}
+	if got := guess("192.0.2.2:1234"); got != http.StatusUnauthorized {
+		t.Errorf("another IP: status = %d, want 401", got)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		forwarded  []string
+		trust      bool
+		want       string
+	}{
+		{"192.0.2.1:1234", nil, false, "192.0.2.1"},
+		{"[2001:db8:1:2:3:4:5:6]:1234", nil, false, "2001:db8:1:2::/64"},
+		{"[::ffff:192.0.2.1]:1234", nil, false, "192.0.2.1"},
+		{"192.0.2.1:1234", []string{"198.51.100.7"}, false, "192.0.2.1"},
+		{"192.0.2.1:1234", []string{"203.0.113.9, 198.51.100.7"}, true, "198.51.100.7"},
+		{"192.0.2.1:1234", []string{"203.0.113.9", "198.51.100.7"}, true, "198.51.100.7"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		for _, v := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := clientIP(r, tt.trust); got != tt.want {
+			t.Errorf("clientIP(%s, %v, trust %t) = %q, want %q", tt.remoteAddr, tt.forwarded, tt.trust, got, tt.want)
+		}
+	}
+}
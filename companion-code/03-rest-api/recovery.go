@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// ErrorReporter sends panics to an error tracker such as Sentry.
+// PHP equivalent: Sentry's Symfony bundle listening on kernel.exception
+type ErrorReporter interface {
+	Report(r *http.Request, err error, stack []byte)
+}
+
+// ErrorReporterFunc lets a plain function be an ErrorReporter.
+type ErrorReporterFunc func(r *http.Request, err error, stack []byte)
+
+func (f ErrorReporterFunc) Report(r *http.Request, err error, stack []byte) { f(r, err, stack) }
+
+// RecoveryMiddleware turns a panic into a logged stack trace and a 500.
+// If the handler had already started the response, a 500 can no longer be
+// sent, so the response is aborted instead: the client sees a broken
+// connection rather than a truncated body that looks complete.
+// Handlers that panic with http.ErrAbortHandler get that abort quietly.
+// reporter may be nil.
+// PHP equivalent: Symfony's ExceptionListener
+func RecoveryMiddleware(reporter ErrorReporter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cw := &commitWriter{ResponseWriter: w}
+
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				err, ok := v.(error)
+				if ok {
+					err = fmt.Errorf("panic: %w", err)
+				} else {
+					err = fmt.Errorf("panic: %v", v)
+				}
+				stack := debug.Stack()
+
+				logf(r.Context(), "Panic recovered (%s %s, response committed: %t): %v\n%s",
+					r.Method, r.URL.Path, cw.committed, v, stack)
+				if reporter != nil {
+					reporter.Report(r, err, stack)
+				}
+
+				if cw.committed {
+					// Makes net/http close the connection (HTTP/1) or reset the stream (HTTP/2)
+					panic(http.ErrAbortHandler)
+				}
+
+				// Drop headers that described the response the handler never finished
+				for _, h := range []string{"Content-Length", "Content-Encoding", "ETag", "Last-Modified"} {
+					w.Header().Del(h)
+				}
+				writeError(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "An unexpected error occurred")
+			}()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// commitWriter records whether the status line has gone out.
+type commitWriter struct {
+	http.ResponseWriter
+	committed bool
+}
+
+func (cw *commitWriter) WriteHeader(status int) {
+	// 1xx responses are informational; the final status is still to come
+	if status >= 200 {
+		cw.committed = true
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *commitWriter) Write(b []byte) (int, error) {
+	cw.committed = true
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush commits the headers, so streaming handlers keep working.
+func (cw *commitWriter) Flush() {
+	cw.committed = true
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (cw *commitWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// reportRecorder is an ErrorReporter that keeps what it was given.
+type reportRecorder struct {
+	errs   []error
+	stacks [][]byte
+}
+
+func (rr *reportRecorder) Report(_ *http.Request, err error, stack []byte) {
+	rr.errs = append(rr.errs, err)
+	rr.stacks = append(rr.stacks, stack)
+}
+
+// serveRecovered runs h behind RequestIDMiddleware and RecoveryMiddleware,
+// returning the response, the log and whatever escaped the middleware.
+func serveRecovered(t *testing.T, reporter ErrorReporter, h http.HandlerFunc) (rec *httptest.ResponseRecorder, logs string, escaped interface{}) {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	req := httptest.NewRequest(http.MethodGet, "/boom", nil)
+	req.Header.Set("X-Request-ID", "trace-7")
+	rec = httptest.NewRecorder()
+	func() {
+		defer func() { escaped = recover() }()
+		RequestIDMiddleware(RecoveryMiddleware(reporter)(h)).ServeHTTP(rec, req)
+	}()
+	return rec, buf.String(), escaped
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	t.Run("before writing", func(t *testing.T) {
+		reporter := &reportRecorder{}
+		rec, logs, escaped := serveRecovered(t, reporter, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"stale"`)
+			panic(errBoom)
+		})
+
+		if escaped != nil {
+			t.Fatalf("panic escaped: %v", escaped)
+		}
+		if rec.Code != http.StatusInternalServerError || rec.Header().Get("ETag") != "" {
+			t.Errorf("status = %d, ETag = %q; want 500 without ETag", rec.Code, rec.Header().Get("ETag"))
+		}
+		var p APIError
+		decodeBody(t, rec, &p)
+		if p.Extensions["code"] != "INTERNAL_ERROR" || p.Extensions["request_id"] != "trace-7" {
+			t.Errorf("problem = %+v", p)
+		}
+
+		// The log has the request ID and the stack down to the panicking handler
+		if !strings.Contains(logs, "[trace-7] Panic recovered (GET /boom, response committed: false): boom") ||
+			!strings.Contains(logs, "TestRecoveryMiddleware") {
+			t.Errorf("log = %s", logs)
+		}
+
+		if len(reporter.errs) != 1 || !errors.Is(reporter.errs[0], errBoom) || !bytes.Contains(reporter.stacks[0], []byte("goroutine")) {
+			t.Errorf("reported %v", reporter.errs)
+		}
+	})
+
+	t.Run("after writing", func(t *testing.T) {
+		reporter := &reportRecorder{}
+		rec, logs, escaped := serveRecovered(t, reporter, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, `[{"id":1},`)
+			panic("half way")
+		})
+
+		// The response is aborted rather than finished with a second status
+		if escaped != http.ErrAbortHandler {
+			t.Fatalf("escaped = %v, want http.ErrAbortHandler", escaped)
+		}
+		if rec.Code != http.StatusOK || rec.Body.String() != `[{"id":1},` {
+			t.Errorf("response = %d %q; want the partial body only", rec.Code, rec.Body)
+		}
+		if !strings.Contains(logs, "response committed: true): half way") {
+			t.Errorf("log = %s", logs)
+		}
+		if len(reporter.errs) != 1 || reporter.errs[0].Error() != "panic: half way" {
+			t.Errorf("reported %v", reporter.errs)
+		}
+	})
+
+	t.Run("abort handler", func(t *testing.T) {
+		reporter := &reportRecorder{}
+		_, logs, escaped := serveRecovered(t, reporter, func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		})
+		if escaped != http.ErrAbortHandler {
+			t.Errorf("escaped = %v, want http.ErrAbortHandler", escaped)
+		}
+		if logs != "" || len(reporter.errs) != 0 {
+			t.Errorf("deliberate abort was logged %q or reported %v", logs, reporter.errs)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/userlist"
+)
+
+// UserRepository stores users. UserStore keeps them in memory and
+// PostgresUserRepository in PostgreSQL; both pass the same contract tests
+// (repository_test.go), so handlers behave the same whichever is chosen.
+//
+// Lookups of a missing user return an error wrapping ErrNotFound, and
+// emails are unique regardless of case (ErrConflict). Returned users are
+// copies: changing one does not change what is stored.
+// PHP equivalent: a repository interface, aliased to its Doctrine implementation in services.yaml
+type UserRepository interface {
+	// Create assigns the ID and UpdatedAt, and CreatedAt unless already set.
+	Create(ctx context.Context, user *User) error
+	FindByID(ctx context.Context, id int64) (*User, error)
+	FindByEmail(ctx context.Context, email string) (*User, error)
+	// List returns one page and the cursor for the next, nil on the last page.
+	List(ctx context.Context, q userlist.Query) ([]*User, *userlist.Cursor, error)
+	// Update applies fn to the current user and saves the result atomically;
+	// if fn returns an error nothing is saved. ID and CreatedAt cannot change.
+	Update(ctx context.Context, id int64, fn func(*User) error) (*User, error)
+	// Delete removes the user if check, when non-nil, accepts it.
+	Delete(ctx context.Context, id int64, check func(*User) error) error
+	// LastModified is when any user was last created, changed or deleted.
+	LastModified(ctx context.Context) (time.Time, error)
+}
+
+var (
+	_ UserRepository = (*UserStore)(nil)
+	_ UserRepository = (*PostgresUserRepository)(nil)
+)
+
+// openRepositories returns the user and API key backends named by the
+// -store flag, and a function to release them.
+func openRepositories(ctx context.Context, backend, databaseURL string) (UserRepository, APIKeyRepository, func() error, error) {
+	switch backend {
+	case "memory":
+		return NewUserStore(), NewAPIKeyStore(), func() error { return nil }, nil
+
+	case "postgres":
+		db, err := sql.Open("postgres", databaseURL)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("open database: %w", err)
+		}
+		// Same pool settings as the database example
+		db.SetMaxOpenConns(25)
+		db.SetMaxIdleConns(5)
+		db.SetConnMaxLifetime(5 * time.Minute)
+
+		users := NewPostgresUserRepository(db)
+		keys := NewPostgresAPIKeyRepository(db)
+		for _, m := range []interface{ Migrate(context.Context) error }{users, keys} {
+			if err := m.Migrate(ctx); err != nil {
+				db.Close()
+				return nil, nil, nil, err
+			}
+		}
+		return users, keys, db.Close, nil
+	}
+	return nil, nil, nil, fmt.Errorf("unknown store %q: want memory or postgres", backend)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/httpx"
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/userlist"
+)
+
+func TestUserStoreContract(t *testing.T) {
+	testUserRepository(t, func(t *testing.T) UserRepository { return NewUserStore() })
+}
+
+// TestPostgresUserRepositoryContract runs against the database named by
+// TEST_DATABASE_URL. Each subtest gets a schema of its own, dropped when it
+// ends, so tables already in the database are never touched.
+func TestPostgresUserRepositoryContract(t *testing.T) {
+	testUserRepository(t, func(t *testing.T) UserRepository {
+		repo := NewPostgresUserRepository(testSchema(t))
+		if err := repo.Migrate(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	})
+}
+
+// testSchema creates an empty schema in the TEST_DATABASE_URL database and
+// returns a pool whose connections use it, skipping t if the variable is
+// not set. The schema is dropped when t ends.
+func testSchema(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := "test_" + randomHex(8)
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Errorf("drop schema %s: %v", schema, err)
+		}
+	})
+
+	// lib/pq sends unknown parameters to the server as settings
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("TEST_DATABASE_URL must be a URL: %v", err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Registered after the drop, so it runs first and frees the schema
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// seedListUsers creates five users a day apart, from 2024-01-01, with a
+// duplicate name to exercise the ID tie-breaker.
+func seedListUsers(t *testing.T, repo UserRepository) time.Time {
+	t.Helper()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, u := range []User{
+		{Name: "Carol", Email: "carol@example.com"},
+		{Name: "alice", Email: "alice@Example.org"},
+		{Name: "Bob", Email: "bob@example.com"},
+		{Name: "Bob", Email: "bobby@test.net"},
+		{Name: "Dave", Email: "dave@example.org"},
+	} {
+		u.CreatedAt = base.Add(time.Duration(i) * 24 * time.Hour)
+		if err := repo.Create(context.Background(), &u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return base
+}
+
+// testUserRepository is the contract every UserRepository must meet.
+// newRepo returns an empty repository.
+func testUserRepository(t *testing.T, newRepo func(t *testing.T) UserRepository) {
+	ctx := context.Background()
+
+	create := func(t *testing.T, repo UserRepository, name, email string) *User {
+		t.Helper()
+		u := &User{Name: name, Email: email, Password: "hash", Roles: []string{RoleUser}}
+		if err := repo.Create(ctx, u); err != nil {
+			t.Fatalf("create %s: %v", email, err)
+		}
+		return u
+	}
+
+	t.Run("create and find", func(t *testing.T) {
+		repo := newRepo(t)
+		alice := create(t, repo, "Alice", "alice@example.com")
+		if alice.ID == 0 || alice.CreatedAt.IsZero() || alice.UpdatedAt.IsZero() {
+			t.Fatalf("ID and timestamps not set: %+v", alice)
+		}
+
+		found, err := repo.FindByID(ctx, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Same representation as the user Create returned, down to the ETag
+		if !reflect.DeepEqual(found, alice) || httpx.ETag(found) != httpx.ETag(alice) {
+			t.Errorf("FindByID = %+v, want %+v", found, alice)
+		}
+
+		byEmail, err := repo.FindByEmail(ctx, "ALICE@Example.COM")
+		if err != nil || byEmail.ID != alice.ID {
+			t.Errorf("FindByEmail ignoring case = %+v, %v", byEmail, err)
+		}
+
+		// Returned users are copies
+		found.Name = "Mallory"
+		if again, _ := repo.FindByID(ctx, alice.ID); again.Name != "Alice" {
+			t.Errorf("changing a returned user changed the store: %q", again.Name)
+		}
+
+		if _, err := repo.FindByID(ctx, alice.ID+100); !errors.Is(err, ErrNotFound) {
+			t.Errorf("FindByID unknown: err = %v, want ErrNotFound", err)
+		}
+		if _, err := repo.FindByEmail(ctx, "nobody@example.com"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("FindByEmail unknown: err = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("create keeps a given creation time", func(t *testing.T) {
+		repo := newRepo(t)
+		at := time.Date(2020, 2, 29, 12, 0, 0, 0, time.UTC)
+		u := &User{Name: "Imported", Email: "imported@example.com", CreatedAt: at}
+		if err := repo.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+		if found, _ := repo.FindByID(ctx, u.ID); !found.CreatedAt.Equal(at) {
+			t.Errorf("CreatedAt = %v, want %v", found.CreatedAt, at)
+		}
+	})
+
+	t.Run("emails unique ignoring case", func(t *testing.T) {
+		repo := newRepo(t)
+		create(t, repo, "Alice", "alice@example.com")
+		bob := create(t, repo, "Bob", "bob@example.com")
+
+		if err := repo.Create(ctx, &User{Name: "Alice 2", Email: "Alice@Example.com"}); !errors.Is(err, ErrConflict) {
+			t.Errorf("Create duplicate: err = %v, want ErrConflict", err)
+		}
+
+		_, err := repo.Update(ctx, bob.ID, func(u *User) error { u.Email = "ALICE@example.com"; return nil })
+		if !errors.Is(err, ErrConflict) {
+			t.Errorf("Update to taken email: err = %v, want ErrConflict", err)
+		}
+		if found, _ := repo.FindByID(ctx, bob.ID); found.Email != "bob@example.com" {
+			t.Errorf("failed update changed the email to %q", found.Email)
+		}
+
+		// Re-casing your own email is not a conflict
+		if _, err := repo.Update(ctx, bob.ID, func(u *User) error { u.Email = "Bob@Example.com"; return nil }); err != nil {
+			t.Errorf("Update own email case: %v", err)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		repo := newRepo(t)
+		alice := create(t, repo, "Alice", "alice@example.com")
+
+		errStop := errors.New("stop")
+		if _, err := repo.Update(ctx, alice.ID, func(u *User) error { u.Name = "Nope"; return errStop }); err != errStop {
+			t.Errorf("Update with failing fn: err = %v, want fn's error", err)
+		}
+		if found, _ := repo.FindByID(ctx, alice.ID); found.Name != "Alice" {
+			t.Errorf("failed update saved the name %q", found.Name)
+		}
+
+		updated, err := repo.Update(ctx, alice.ID, func(u *User) error {
+			u.Name = "Alice Smith"
+			u.Roles = []string{RoleUser, RoleAdmin}
+			u.ID = 999                // Ignored
+			u.CreatedAt = time.Time{} // Ignored
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.ID != alice.ID || !updated.CreatedAt.Equal(alice.CreatedAt) || updated.UpdatedAt.Before(alice.UpdatedAt) {
+			t.Errorf("ID or timestamps wrong after update: %+v", updated)
+		}
+		found, _ := repo.FindByID(ctx, alice.ID)
+		if !reflect.DeepEqual(found, updated) {
+			t.Errorf("FindByID after update = %+v, want %+v", found, updated)
+		}
+
+		if _, err := repo.Update(ctx, alice.ID+100, func(*User) error { return nil }); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Update unknown: err = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		repo := newRepo(t)
+		alice := create(t, repo, "Alice", "alice@example.com")
+
+		if err := repo.Delete(ctx, alice.ID, func(*User) error { return httpx.ErrPreconditionFailed }); !errors.Is(err, httpx.ErrPreconditionFailed) {
+			t.Errorf("Delete with failing check: err = %v", err)
+		}
+		if _, err := repo.FindByID(ctx, alice.ID); err != nil {
+			t.Errorf("failed delete removed the user: %v", err)
+		}
+
+		if err := repo.Delete(ctx, alice.ID, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.FindByID(ctx, alice.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("FindByID after delete: err = %v, want ErrNotFound", err)
+		}
+		if err := repo.Delete(ctx, alice.ID, nil); !errors.Is(err, ErrNotFound) {
+			t.Errorf("second Delete: err = %v, want ErrNotFound", err)
+		}
+		// The email is free again
+		create(t, repo, "Alice", "alice@example.com")
+	})
+
+	t.Run("last modified includes deletes", func(t *testing.T) {
+		repo := newRepo(t)
+		alice := create(t, repo, "Alice", "alice@example.com")
+		before, err := repo.LastModified(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(2 * time.Millisecond)
+		if err := repo.Delete(ctx, alice.ID, nil); err != nil {
+			t.Fatal(err)
+		}
+		if after, _ := repo.LastModified(ctx); !after.After(before) {
+			t.Errorf("LastModified = %v after delete, was %v", after, before)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		repo := newRepo(t)
+		base := seedListUsers(t, repo)
+
+		tests := []struct {
+			name string
+			q    userlist.Query
+			want []int64
+		}{
+			{"by id", userlist.Query{Sort: "id"}, []int64{1, 2, 3, 4, 5}},
+			{"by id desc", userlist.Query{Sort: "id", Desc: true}, []int64{5, 4, 3, 2, 1}},
+			{"by name, ties by id", userlist.Query{Sort: "name"}, []int64{3, 4, 1, 5, 2}},
+			{"by name desc", userlist.Query{Sort: "name", Desc: true}, []int64{2, 5, 1, 4, 3}},
+			{"by email", userlist.Query{Sort: "email"}, []int64{2, 3, 4, 1, 5}},
+			{"by created_at desc", userlist.Query{Sort: "created_at", Desc: true}, []int64{5, 4, 3, 2, 1}},
+			{"name contains", userlist.Query{Sort: "id", NameContains: "o"}, []int64{1, 3, 4}},
+			{"email domain", userlist.Query{Sort: "id", EmailDomain: "EXAMPLE.org"}, []int64{2, 5}},
+			{"created range", userlist.Query{Sort: "id", CreatedAfter: base, CreatedBefore: base.Add(72 * time.Hour)}, []int64{2, 3}},
+		}
+
+		for _, tt := range tests {
+			// Walk every page of two, so each case also crosses page boundaries
+			t.Run(tt.name, func(t *testing.T) {
+				q := tt.q
+				q.Limit = 2
+				var got []int64
+				for pages := 0; pages < 10; pages++ {
+					users, next, err := repo.List(ctx, q)
+					if err != nil {
+						t.Fatal(err)
+					}
+					for _, u := range users {
+						got = append(got, u.ID)
+					}
+					if next == nil {
+						break
+					}
+					q.After = next
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+
+	// A cursor still works after the row it points at is deleted and a
+	// new row is added
+	t.Run("list is stable under writes", func(t *testing.T) {
+		repo := newRepo(t)
+		seedListUsers(t, repo)
+
+		first, next, err := repo.List(ctx, userlist.Query{Sort: "id", Limit: 2})
+		if err != nil || len(first) != 2 || next == nil {
+			t.Fatalf("first page: %d users, next %v, err %v", len(first), next, err)
+		}
+		if err := repo.Delete(ctx, 2, nil); err != nil {
+			t.Fatal(err)
+		}
+		create(t, repo, "Eve", "eve@example.com")
+
+		second, _, err := repo.List(ctx, userlist.Query{Sort: "id", Limit: 2, After: next})
+		if err != nil || len(second) != 2 || second[0].ID != 3 || second[1].ID != 4 {
+			t.Errorf("second page = %v, %v; want users 3 and 4", second, err)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/httpx"
+)
+
+// RequestIDMiddleware gives each request an ID: the caller's X-Request-ID
+// if it is well-formed, so one ID follows a request through every service,
+// or a new UUIDv7. The ID is echoed in the response, stored in the context
+// for logf and error bodies, and forwarded by RequestIDTransport.
+// It should be the outermost middleware so everything else can log it.
+// PHP equivalent: Symfony Uid component with EventListener
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !httpx.ValidRequestID(requestID) {
+			requestID = httpx.NewRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		next.ServeHTTP(w, r.WithContext(httpx.WithRequestID(r.Context(), requestID)))
+	})
+}
+
+// logf logs with the request ID of ctx, if any, so every line about a
+// request can be found from the ID in its error body.
+// PHP equivalent: a Monolog processor adding extra.request_id
+func logf(ctx context.Context, format string, args ...interface{}) {
+	if id := httpx.RequestIDFromContext(ctx); id != "" {
+		format = "[" + id + "] " + format
+	}
+	log.Printf(format, args...)
+}
+
+// RequestIDTransport forwards the request ID of each outgoing request's
+// context, so calls to other services can be traced back to ours. Build
+// outgoing requests with http.NewRequestWithContext(r.Context(), ...).
+// PHP equivalent: a HttpClient decorator adding the header to every request
+type RequestIDTransport struct {
+	// Base performs the request; nil means http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+func (t *RequestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	id := httpx.RequestIDFromContext(req.Context())
+	if id == "" || req.Header.Get("X-Request-ID") != "" {
+		return base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the caller's request
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Request-ID", id)
+	return base.RoundTrip(req)
+}
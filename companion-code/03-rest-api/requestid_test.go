@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/httpx"
+)
+
+var uuidV7 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var fromContext string
+	h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fromContext = httpx.RequestIDFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name    string
+		inbound string
+		keep    bool
+	}{
+		{"none", "", false},
+		{"uuid", "0190a0b2-6c4e-7d2a-9f3e-1a2b3c4d5e6f", true},
+		{"ulid", "01J2X8ZK7Q9M3N4P5R6S7T8V9W", true},
+		{"proxy style", "req_abc.123:456", true},
+		{"log injection", "abc\nINFO forged line", false},
+		{"spaces", "abc def", false},
+		{"too long", strings.Repeat("a", httpx.MaxRequestIDLength+1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.inbound != "" {
+				req.Header["X-Request-Id"] = []string{tt.inbound}
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			got := rec.Header().Get("X-Request-ID")
+			if tt.keep && got != tt.inbound {
+				t.Errorf("X-Request-ID = %q, want the inbound %q", got, tt.inbound)
+			}
+			if !tt.keep && !uuidV7.MatchString(got) {
+				t.Errorf("X-Request-ID = %q, want a new UUIDv7", got)
+			}
+			if fromContext != got {
+				t.Errorf("context ID = %q, response ID = %q", fromContext, got)
+			}
+		})
+	}
+}
+
+func TestRequestIDInErrorsAndLogs(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeErrorFor(w, r, context.DeadlineExceeded)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("X-Request-ID", "trace-42")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var p APIError
+	decodeBody(t, rec, &p)
+	if p.Extensions["request_id"] != "trace-42" {
+		t.Errorf("problem request_id = %v, want trace-42", p.Extensions["request_id"])
+	}
+	if !strings.Contains(logs.String(), "[trace-42] Internal error: context deadline exceeded") {
+		t.Errorf("log = %q, want the request ID", logs.String())
+	}
+}
+
+func TestRequestIDTransport(t *testing.T) {
+	var received []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("X-Request-ID"))
+	}))
+	defer upstream.Close()
+
+	client := &http.Client{Transport: &RequestIDTransport{}}
+	call := func(ctx context.Context, header string) {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL, nil)
+		if header != "" {
+			req.Header.Set("X-Request-ID", header)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if req.Header.Get("X-Request-ID") != header {
+			t.Error("the transport modified the caller's request")
+		}
+	}
+
+	ctx := httpx.WithRequestID(context.Background(), "trace-42")
+	call(ctx, "")
+	call(ctx, "explicit")
+	call(context.Background(), "")
+
+	want := []string{"trace-42", "explicit", ""}
+	for i := range want {
+		if received[i] != want[i] {
+			t.Errorf("call %d sent X-Request-ID %q, want %q", i+1, received[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/userlist"
+)
+
+// UserStore is an in-memory UserRepository, for development and tests.
+// Stored users are never changed in place: readers get copies, and writes
+// swap in a new value, so a *User handed out earlier never changes under its holder.
+// PHP equivalent: none - PHP-FPM shares no memory between requests
+type UserStore struct {
+	mu       sync.RWMutex
+	users    map[int64]*User
+	nextID   int64
+	modified time.Time // Last change of any kind, for Last-Modified on lists
+}
+
+func NewUserStore() *UserStore {
+	return &UserStore{
+		users:    make(map[int64]*User),
+		nextID:   1,
+		modified: time.Now(),
+	}
+}
+
+// Create stores a new user. Emails are unique regardless of case, as
+// enforced by the unique index on lower(email) in the SQL schema.
+// PHP equivalent: #[UniqueEntity('email')] plus the database constraint
+func (s *UserStore) Create(_ context.Context, user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkEmailFree(user.Email, 0); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	user.ID = s.nextID
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	user.UpdatedAt = now
+	stored := *user
+	s.users[user.ID] = &stored
+	s.nextID++
+	s.modified = now
+	return nil
+}
+
+// checkEmailFree returns ErrConflict if a user other than except has the
+// email. The caller must hold the write lock.
+func (s *UserStore) checkEmailFree(email string, except int64) error {
+	for _, u := range s.users {
+		if u.ID != except && strings.EqualFold(u.Email, email) {
+			return fmt.Errorf("email %s: %w", email, ErrConflict)
+		}
+	}
+	return nil
+}
+
+// FindByID returns the user with the given ID.
+func (s *UserStore) FindByID(_ context.Context, id int64) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user %d: %w", id, ErrNotFound)
+	}
+	found := *u
+	return &found, nil
+}
+
+// FindByEmail returns the user with the given email, ignoring case.
+// PHP equivalent: $repository->findOneBy(['email' => $email])
+func (s *UserStore) FindByEmail(_ context.Context, email string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, u := range s.users {
+		if strings.EqualFold(u.Email, email) {
+			found := *u
+			return &found, nil
+		}
+	}
+	return nil, fmt.Errorf("user %s: %w", email, ErrNotFound)
+}
+
+// Update applies fn to a copy of the user and saves the result, under one
+// lock so concurrent writes cannot overwrite each other. If fn returns an
+// error, or the new email belongs to someone else (ErrConflict), the user
+// is left untouched.
+// PHP equivalent: $em->wrapInTransaction(fn () => ...)
+func (s *UserStore) Update(_ context.Context, id int64, fn func(*User) error) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user %d: %w", id, ErrNotFound)
+	}
+	updated := *u
+	if err := fn(&updated); err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(updated.Email, u.Email) {
+		if err := s.checkEmailFree(updated.Email, id); err != nil {
+			return nil, err
+		}
+	}
+	updated.ID = id                 // The ID is immutable
+	updated.CreatedAt = u.CreatedAt // So is the creation time
+	updated.UpdatedAt = time.Now()
+	s.users[id] = &updated
+	s.modified = updated.UpdatedAt
+
+	result := updated
+	return &result, nil
+}
+
+// Delete removes a user if check, when non-nil, returns nil for it.
+// The check runs under the same lock as the delete.
+// PHP equivalent: $em->remove($user); $em->flush();
+func (s *UserStore) Delete(_ context.Context, id int64, check func(*User) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return fmt.Errorf("user %d: %w", id, ErrNotFound)
+	}
+	if check != nil {
+		current := *u
+		if err := check(&current); err != nil {
+			return err
+		}
+	}
+	delete(s.users, id)
+	s.modified = time.Now()
+	return nil
+}
+
+// List returns one page of users matching q, and the cursor for the next
+// page, or nil on the last one.
+// PHP equivalent: $repository->matching(Criteria::create()->where(...)->orderBy(...)->setMaxResults(...))
+func (s *UserStore) List(_ context.Context, q userlist.Query) ([]*User, *userlist.Cursor, error) {
+	s.mu.RLock()
+	users := make([]*User, 0, len(s.users))
+	for _, u := range s.users {
+		if matchesQuery(q, u) {
+			found := *u
+			users = append(users, &found)
+		}
+	}
+	s.mu.RUnlock()
+
+	// Map order is random; ties on the sort field are broken by ID so
+	// the order, and with it every page and list ETag, is stable
+	sort.Slice(users, func(i, j int) bool {
+		c := compareUsers(users[i], users[j], q.Sort)
+		if q.Desc {
+			c = -c
+		}
+		return c < 0
+	})
+
+	if q.After != nil {
+		start := sort.Search(len(users), func(i int) bool {
+			c := compareToCursor(users[i], q.After)
+			if q.Desc {
+				c = -c
+			}
+			return c > 0
+		})
+		users = users[start:]
+	}
+
+	if len(users) <= q.Limit {
+		return users, nil, nil
+	}
+	users = users[:q.Limit]
+	last := users[len(users)-1]
+	return users, q.CursorAfter(last.ID, last.Name, last.Email, last.CreatedAt), nil
+}
+
+// matchesQuery reports whether u passes the query's filters.
+func matchesQuery(q userlist.Query, u *User) bool {
+	if q.NameContains != "" && !strings.Contains(strings.ToLower(u.Name), strings.ToLower(q.NameContains)) {
+		return false
+	}
+	if q.EmailDomain != "" && !strings.HasSuffix(strings.ToLower(u.Email), "@"+strings.ToLower(q.EmailDomain)) {
+		return false
+	}
+	if !q.CreatedAfter.IsZero() && !u.CreatedAt.After(q.CreatedAfter) {
+		return false
+	}
+	if !q.CreatedBefore.IsZero() && !u.CreatedAt.Before(q.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+// compareUsers orders users by field, then by ID.
+func compareUsers(a, b *User, field string) int {
+	var c int
+	switch field {
+	case "name":
+		c = strings.Compare(a.Name, b.Name)
+	case "email":
+		c = strings.Compare(a.Email, b.Email)
+	case "created_at":
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if c != 0 {
+		return c
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
+
+// compareToCursor orders a user against a cursor position, as compareUsers does.
+// The cursor value was checked when it was decoded.
+func compareToCursor(u *User, after *userlist.Cursor) int {
+	var c int
+	switch after.Sort {
+	case "name":
+		c = strings.Compare(u.Name, after.Value)
+	case "email":
+		c = strings.Compare(u.Email, after.Value)
+	case "created_at":
+		t, _ := time.Parse(time.RFC3339Nano, after.Value)
+		c = u.CreatedAt.Compare(t)
+	}
+	if c != 0 {
+		return c
+	}
+	return cmp.Compare(u.ID, after.ID)
+}
+
+// LastModified returns when the collection last changed.
+func (s *UserStore) LastModified(context.Context) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.modified, nil
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrRefreshTokenInvalid is returned for unknown or expired refresh tokens.
+	ErrRefreshTokenInvalid = fmt.Errorf("%w: invalid refresh token", ErrUnauthorised)
+	// ErrRefreshTokenReused is returned when an already rotated refresh token
+	// is presented again - a sign it was stolen. Its whole family is revoked.
+	ErrRefreshTokenReused = fmt.Errorf("%w: refresh token reuse detected", ErrUnauthorised)
+)
+
+// Denylist records revoked access tokens by jti until they would have expired.
+// Implementations must be safe for concurrent use; a shared store such as
+// Redis lets every instance see a logout.
+// PHP equivalent: Lexik's BlockedTokenManager backed by a cache pool
+type Denylist interface {
+	Revoke(ctx context.Context, jti string, until time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// RefreshToken is the server-side record of an issued refresh token.
+// Tokens created by rotating one another share a Family.
+type RefreshToken struct {
+	UserID    int64
+	Family    string
+	ExpiresAt time.Time
+}
+
+// RefreshStore keeps refresh tokens, keyed by a hash of the token so a
+// leaked store cannot be replayed.
+// PHP equivalent: gesdinet_jwt_refresh_token's refresh_tokens table
+type RefreshStore interface {
+	Save(ctx context.Context, hash string, t RefreshToken) error
+	// Consume marks the token used and returns it. Consuming a used token
+	// returns ErrRefreshTokenReused together with the record.
+	Consume(ctx context.Context, hash string) (RefreshToken, error)
+	RevokeFamily(ctx context.Context, family string) error
+}
+
+// TokenPair is the response of the login and refresh endpoints.
+// PHP equivalent: the JSON returned by Lexik's AuthenticationSuccessHandler
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"` // Seconds until the access token expires
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenService issues short-lived HS256 access tokens and rotating opaque
+// refresh tokens, and revokes both on logout.
+type TokenService struct {
+	cfg      JWTConfig
+	users    UserRepository
+	refresh  RefreshStore
+	denylist Denylist
+	now      func() time.Time
+}
+
+// firstPartyScope is granted to tokens from POST /auth/login: the API's own
+// clients may do anything their roles allow.
+var firstPartyScope = strings.Join([]string{ScopeUsersRead, ScopeUsersWrite}, " ")
+
+// minSecretBytes is the shortest HS256 secret accepted: RFC 7518 §3.2
+// requires a key at least as long as the hash output.
+const minSecretBytes = 32
+
+// NewTokenService returns a service signing with cfg.Secret. Users are looked
+// up again on every refresh, so role changes and deletions take effect then.
+func NewTokenService(cfg JWTConfig, users UserRepository, refresh RefreshStore, denylist Denylist) (*TokenService, error) {
+	if len(cfg.Secret) < minSecretBytes {
+		return nil, fmt.Errorf("issuing tokens needs JWT_SECRET of at least %d bytes", minSecretBytes)
+	}
+	return &TokenService{cfg: cfg, users: users, refresh: refresh, denylist: denylist, now: time.Now}, nil
+}
+
+// Issue starts a new session for the user.
+func (s *TokenService) Issue(ctx context.Context, user *User) (TokenPair, error) {
+	return s.issue(ctx, user, randomToken())
+}
+
+// Refresh exchanges a refresh token for a new pair. The old refresh token
+// stops working; presenting it again revokes every token in its family.
+func (s *TokenService) Refresh(ctx context.Context, refreshToken string) (TokenPair, error) {
+	rt, err := s.refresh.Consume(ctx, hashToken(refreshToken))
+	if errors.Is(err, ErrRefreshTokenReused) {
+		if revokeErr := s.refresh.RevokeFamily(ctx, rt.Family); revokeErr != nil {
+			return TokenPair{}, revokeErr
+		}
+		return TokenPair{}, err
+	}
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if !s.now().Before(rt.ExpiresAt) {
+		return TokenPair{}, ErrRefreshTokenInvalid
+	}
+
+	user, err := s.users.FindByID(ctx, rt.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return TokenPair{}, ErrRefreshTokenInvalid // Deleted since login
+	}
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return s.issue(ctx, user, rt.Family)
+}
+
+// Revoke denylists the access token and, if given, ends the refresh token's session.
+func (s *TokenService) Revoke(ctx context.Context, access *Claims, refreshToken string) error {
+	if access.ID != "" {
+		if err := s.denylist.Revoke(ctx, access.ID, time.Unix(access.ExpiresAt, 0)); err != nil {
+			return err
+		}
+	}
+	if refreshToken == "" {
+		return nil
+	}
+
+	// Holding the refresh token is proof enough to end its session
+	rt, err := s.refresh.Consume(ctx, hashToken(refreshToken))
+	if err != nil && !errors.Is(err, ErrRefreshTokenReused) {
+		return nil // Unknown or expired: nothing left to revoke
+	}
+	return s.refresh.RevokeFamily(ctx, rt.Family)
+}
+
+func (s *TokenService) issue(ctx context.Context, user *User, family string) (TokenPair, error) {
+	now := s.now()
+	claims := Claims{
+		Subject:   strconv.FormatInt(user.ID, 10),
+		Issuer:    s.cfg.Issuer,
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: now.Add(s.cfg.AccessTTL).Unix(),
+		ID:        randomToken(),
+		Roles:     user.Roles,
+		Scope:     firstPartyScope,
+	}
+	if s.cfg.Audience != "" {
+		claims.Audience = audience{s.cfg.Audience}
+	}
+
+	access, err := signHS256(s.cfg.Secret, claims)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	refresh := randomToken()
+	err = s.refresh.Save(ctx, hashToken(refresh), RefreshToken{
+		UserID:    user.ID,
+		Family:    family,
+		ExpiresAt: now.Add(s.cfg.RefreshTTL),
+	})
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.cfg.AccessTTL / time.Second),
+		RefreshToken: refresh,
+	}, nil
+}
+
+// randomToken returns 256 random bits, base64url-encoded.
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// --- In-memory stores (use Redis or the database with several instances) ---
+
+// MemoryDenylist is a Denylist for a single instance.
+type MemoryDenylist struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time // jti -> when the token expires anyway
+}
+
+func NewMemoryDenylist() *MemoryDenylist {
+	return &MemoryDenylist{revoked: make(map[string]time.Time)}
+}
+
+func (d *MemoryDenylist) Revoke(_ context.Context, jti string, until time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Expired tokens are rejected anyway; drop them to bound memory
+	now := time.Now()
+	for id, exp := range d.revoked {
+		if now.After(exp) {
+			delete(d.revoked, id)
+		}
+	}
+	d.revoked[jti] = until
+	return nil
+}
+
+func (d *MemoryDenylist) IsRevoked(_ context.Context, jti string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.revoked[jti]
+	return ok, nil
+}
+
+type refreshEntry struct {
+	RefreshToken
+	used bool
+}
+
+// MemoryRefreshStore is a RefreshStore for a single instance.
+type MemoryRefreshStore struct {
+	mu     sync.Mutex
+	tokens map[string]*refreshEntry
+}
+
+func NewMemoryRefreshStore() *MemoryRefreshStore {
+	return &MemoryRefreshStore{tokens: make(map[string]*refreshEntry)}
+}
+
+func (s *MemoryRefreshStore) Save(_ context.Context, hash string, t RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for h, e := range s.tokens {
+		if now.After(e.ExpiresAt) {
+			delete(s.tokens, h)
+		}
+	}
+	s.tokens[hash] = &refreshEntry{RefreshToken: t}
+	return nil
+}
+
+func (s *MemoryRefreshStore) Consume(_ context.Context, hash string) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.tokens[hash]
+	if !ok {
+		return RefreshToken{}, ErrRefreshTokenInvalid
+	}
+	if e.used {
+		return e.RefreshToken, ErrRefreshTokenReused
+	}
+	e.used = true // Kept, not deleted, so a replay can be recognised
+	return e.RefreshToken, nil
+}
+
+func (s *MemoryRefreshStore) RevokeFamily(_ context.Context, family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for h, e := range s.tokens {
+		if e.Family == family {
+			delete(s.tokens, h)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/httpx"
+)
+
+// mergePatchType is the media type of JSON Merge Patch documents (RFC 7396).
+const mergePatchType = "application/merge-patch+json"
+
+// UpdateUserRequest holds the fields a client may change on a user.
+// PUT must send all of them; PATCH merges into the current values.
+// PHP equivalent: an edit form type bound to the User entity
+type UpdateUserRequest struct {
+	Name  string `json:"name" validate:"required,max=100"`
+	Email string `json:"email" validate:"required,email"`
+}
+
+// GetUser returns a single user.
+// PHP equivalent: UserController::show(User $user) with #[Route('/users/{id}', methods: ['GET'])]
+func (api *API) GetUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := userID(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := api.users.FindByID(r.Context(), id)
+	if err != nil {
+		writeErrorFor(w, r, err)
+		return
+	}
+
+	// Tell clients which PATCH format we accept (RFC 5789 §3.1)
+	w.Header().Set("Accept-Patch", mergePatchType)
+	if httpx.NotModified(w, r, httpx.ETag(user), user.UpdatedAt) {
+		return
+	}
+
+	httpx.Render(w, r, http.StatusOK, user)
+}
+
+// ReplaceUser replaces a user's editable fields.
+// PHP equivalent: UserController::update() with #[Route(methods: ['PUT'])]
+func (api *API) ReplaceUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := userID(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := httpx.DecodeJSON(w, r, &req); err != nil {
+		httpx.WriteDecodeError(w, r, err)
+		return
+	}
+	if !validRequest(w, r, &req) {
+		return
+	}
+
+	user, err := api.users.Update(r.Context(), id, func(u *User) error {
+		// Optimistic concurrency: reject if the client edited a stale copy
+		if err := httpx.CheckIfMatch(r, *u); err != nil {
+			return err
+		}
+		u.Name = req.Name
+		u.Email = req.Email
+		return nil
+	})
+	if err != nil {
+		writeErrorFor(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", httpx.ETag(user))
+	httpx.Render(w, r, http.StatusOK, user)
+}
+
+// PatchUser applies a JSON Merge Patch to a user: members set to null are
+// removed, objects are merged and anything else replaces the current value.
+// The patched result is validated like a PUT body, so removing a required
+// field is a validation error.
+// PHP equivalent: UserController::patch() with $form->submit($data, false)
+func (api *API) PatchUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := userID(w, r)
+	if !ok {
+		return
+	}
+
+	var patch json.RawMessage
+	if err := httpx.DecodeJSON(w, r, &patch); err != nil {
+		httpx.WriteDecodeError(w, r, err)
+		return
+	}
+
+	locale := validate.Locale(r)
+	user, err := api.users.Update(r.Context(), id, func(u *User) error {
+		if err := httpx.CheckIfMatch(r, *u); err != nil {
+			return err
+		}
+
+		// Patch the editable fields as a JSON document, then decode the
+		// result as strictly as a request body
+		current, err := json.Marshal(UpdateUserRequest{Name: u.Name, Email: u.Email})
+		if err != nil {
+			return err
+		}
+		merged, err := mergePatch(current, patch)
+		if err != nil {
+			return err
+		}
+
+		var req UpdateUserRequest
+		dec := json.NewDecoder(bytes.NewReader(merged))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			return httpx.TranslateDecodeError(err)
+		}
+		if errs := validate.Struct(&req, locale); len(errs) > 0 {
+			return ValidationErrors(errs)
+		}
+
+		u.Name = req.Name
+		u.Email = req.Email
+		return nil
+	})
+
+	var decodeErr *httpx.DecodeError
+	switch {
+	case errors.As(err, &decodeErr):
+		httpx.WriteDecodeError(w, r, err)
+		return
+	case err != nil:
+		writeErrorFor(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", httpx.ETag(user))
+	httpx.Render(w, r, http.StatusOK, user)
+}
+
+// DeleteUser removes a user. Their refresh tokens stop working at once;
+// access tokens already issued expire on their own.
+// PHP equivalent: UserController::delete()
+func (api *API) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := userID(w, r)
+	if !ok {
+		return
+	}
+
+	err := api.users.Delete(r.Context(), id, func(u *User) error {
+		return httpx.CheckIfMatch(r, *u)
+	})
+	if err != nil {
+		writeErrorFor(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// userID parses the {id} path parameter, writing a 400 if it is not a number.
+// PHP equivalent: requirements: ['id' => '\d+'] on the route
+func userID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		writeError(w, r, http.StatusBadRequest, "BAD_REQUEST", "Invalid user ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// mergePatch applies an RFC 7396 merge patch to a JSON document.
+func mergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p interface{}
+	if err := unmarshalNumbers(doc, &target); err != nil {
+		return nil, err
+	}
+	if err := unmarshalNumbers(patch, &p); err != nil {
+		return nil, err
+	}
+	return json.Marshal(applyMergePatch(target, p))
+}
+
+// applyMergePatch is the MergePatch function from RFC 7396 §2.
+func applyMergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+			continue
+		}
+		t[name] = applyMergePatch(t[name], value)
+	}
+	return t
+}
+
+// unmarshalNumbers decodes JSON keeping numbers as written, so a patch
+// does not round large integers through float64.
+func unmarshalNumbers(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
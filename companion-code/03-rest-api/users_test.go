@@ -0,0 +1,195 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestMergePatch uses examples from RFC 7396 Appendix A.
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{`{"n":1}`, `{"m":9007199254740993}`, `{"m":9007199254740993,"n":1}`},
+	}
+
+	for _, tt := range tests {
+		got, err := mergePatch([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Fatalf("mergePatch(%s, %s): %v", tt.doc, tt.patch, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("mergePatch(%s, %s) = %s, want %s", tt.doc, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestUserResource(t *testing.T) {
+	h := newAuthServer(t)
+	alice := login(t, h, "alice@example.com")
+	admin := login(t, h, "admin@example.com")
+
+	t.Run("get", func(t *testing.T) {
+		rec := doJSON(t, h, http.MethodGet, "/users/1", alice, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+		}
+		if rec.Header().Get("ETag") == "" || rec.Header().Get("Accept-Patch") != mergePatchType {
+			t.Errorf("missing ETag or Accept-Patch: %v", rec.Header())
+		}
+		var user User
+		decodeBody(t, rec, &user)
+		if user.ID != 1 || user.Name != "Alice" {
+			t.Errorf("got %+v, want Alice", user)
+		}
+	})
+
+	t.Run("get errors", func(t *testing.T) {
+		if rec := doJSON(t, h, http.MethodGet, "/users/99", alice, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("unknown user: status = %d, want 404", rec.Code)
+		}
+		if rec := doJSON(t, h, http.MethodGet, "/users/abc", alice, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("bad ID: status = %d, want 400", rec.Code)
+		}
+		if rec := doJSON(t, h, http.MethodGet, "/users/1", "", ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("anonymous: status = %d, want 401", rec.Code)
+		}
+	})
+
+	t.Run("put", func(t *testing.T) {
+		rec := doJSON(t, h, http.MethodPut, "/users/1", alice, `{"name":"Alice Smith","email":"alice@example.org"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+		}
+		var user User
+		decodeBody(t, rec, &user)
+		if user.Name != "Alice Smith" || user.Email != "alice@example.org" {
+			t.Errorf("got %+v", user)
+		}
+
+		// PUT replaces everything, so a missing field is an error
+		rec = doJSON(t, h, http.MethodPut, "/users/1", alice, `{"name":"Alice"}`)
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("partial PUT: status = %d, want 422", rec.Code)
+		}
+	})
+
+	t.Run("email taken", func(t *testing.T) {
+		rec := doJSON(t, h, http.MethodPut, "/users/1", alice, `{"name":"Alice","email":"ADMIN@example.com"}`)
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("status = %d, want 409: %s", rec.Code, rec.Body)
+		}
+		var apiErr APIError
+		decodeBody(t, rec, &apiErr)
+		if apiErr.Extensions["code"] != "CONFLICT" {
+			t.Errorf("error code = %v, want CONFLICT", apiErr.Extensions["code"])
+		}
+
+		// Changing only the case of your own email is fine
+		rec = doJSON(t, h, http.MethodPut, "/users/1", alice, `{"name":"Alice Smith","email":"ALICE@example.org"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("own email: status = %d, want 200: %s", rec.Code, rec.Body)
+		}
+		rec = doJSON(t, h, http.MethodPut, "/users/1", alice, `{"name":"Alice Smith","email":"alice@example.org"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("restore email: status = %d, want 200: %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("patch", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			body   string
+			status int
+			want   string
+		}{
+			{"merge one field", `{"name":"Ally"}`, http.StatusOK, "Ally"},
+			{"null removes a required field", `{"name":null}`, http.StatusUnprocessableEntity, ""},
+			{"invalid value", `{"email":"not-an-email"}`, http.StatusUnprocessableEntity, ""},
+			{"unknown field", `{"roles":["ROLE_ADMIN"]}`, http.StatusBadRequest, ""},
+			{"wrong type", `{"name":5}`, http.StatusBadRequest, ""},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPatch, "/users/1", strings.NewReader(tt.body))
+				req.Header.Set("Content-Type", mergePatchType)
+				req.Header.Set("Authorization", "Bearer "+alice)
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+
+				if rec.Code != tt.status {
+					t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+				}
+				if tt.want == "" {
+					return
+				}
+				var user User
+				decodeBody(t, rec, &user)
+				if user.Name != tt.want || user.Email != "alice@example.org" {
+					t.Errorf("got %+v", user)
+				}
+			})
+		}
+	})
+
+	t.Run("stale If-Match", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPatch, "/users/1", strings.NewReader(`{"name":"Al"}`))
+		req.Header.Set("Content-Type", mergePatchType)
+		req.Header.Set("Authorization", "Bearer "+alice)
+		req.Header.Set("If-Match", `"stale"`)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusPreconditionFailed {
+			t.Errorf("status = %d, want 412: %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("owner only", func(t *testing.T) {
+		if rec := doJSON(t, h, http.MethodPatch, "/users/2", alice, `{"name":"Mallory"}`); rec.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want 403", rec.Code)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if rec := doJSON(t, h, http.MethodDelete, "/users/1", admin, ""); rec.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want 204: %s", rec.Code, rec.Body)
+		}
+		if rec := doJSON(t, h, http.MethodGet, "/users/1", admin, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("after delete: status = %d, want 404", rec.Code)
+		}
+		if rec := doJSON(t, h, http.MethodDelete, "/users/1", admin, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("second delete: status = %d, want 404", rec.Code)
+		}
+	})
+}
+
+func TestCreateUserConflict(t *testing.T) {
+	h := newAuthServer(t)
+
+	rec := doJSON(t, h, http.MethodPost, "/users", "", `{"name":"Alice Again","email":"Alice@Example.com","password":"long enough"}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Content-Type = %q, want application/problem+json", ct)
+	}
+
+	rec = doJSON(t, h, http.MethodPost, "/users", "", `{"name":"Carol","email":"carol@example.com","password":"long enough"}`)
+	if rec.Code != http.StatusCreated {
+		t.Errorf("new email: status = %d, want 201: %s", rec.Code, rec.Body)
+	}
+}
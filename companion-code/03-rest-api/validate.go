@@ -0,0 +1,537 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/httpx"
+)
+
+// RuleFunc reports whether a value passes a rule. param is the text after
+// "=" in the tag, e.g. "8" for min=8. Rules other than "required" only see
+// non-empty values.
+type RuleFunc func(v reflect.Value, param string) bool
+
+// Validator checks structs against their `validate` tags and returns
+// {field: message} for every failing field, using the request DTOs' JSON
+// names. Tags list rules separated by commas:
+//
+//	required        not empty; strings are trimmed first
+//	min=N, max=N    length of strings (in characters) and slices, or numeric value
+//	email           a bare address such as alice@example.com
+//	url             an absolute http or https URL
+//	oneof=a b c     one of the space-separated values
+//	regex=PATTERN   matches PATTERN; must come last, as it may contain commas
+//	dive            the rules after it apply to each element of a slice
+//
+// Each struct type's tags are parsed and checked once, on Register or on
+// first use; an unknown rule, a regex that does not compile or a min or
+// max that is not a number is an error, not a failing field.
+// Nested structs, pointers to structs and slices of structs are validated
+// recursively, with paths such as "address.city" and "items[2].name".
+// PHP equivalent: Symfony Validator with #[Assert\...] attributes
+type Validator struct {
+	mu       sync.RWMutex
+	rules    map[string]RuleFunc
+	messages map[string]map[string]string // locale -> message key -> template
+	regexps  sync.Map                     // pattern -> *regexp.Regexp
+	structs  sync.Map                     // reflect.Type -> []fieldRules
+}
+
+// defaultLocale is used when the client asks for a language we lack.
+const defaultLocale = "en"
+
+// validate is the validator shared by every handler.
+var validate = NewValidator()
+
+// NewValidator returns a validator with the built-in rules and their
+// English and French messages.
+func NewValidator() *Validator {
+	v := &Validator{
+		rules:    make(map[string]RuleFunc),
+		messages: make(map[string]map[string]string),
+	}
+
+	v.rules["required"] = func(rv reflect.Value, _ string) bool { return !isEmpty(rv) }
+	v.rules["min"] = func(rv reflect.Value, p string) bool {
+		return compareSize(rv, p, func(n, limit float64) bool { return n >= limit })
+	}
+	v.rules["max"] = func(rv reflect.Value, p string) bool {
+		return compareSize(rv, p, func(n, limit float64) bool { return n <= limit })
+	}
+	v.rules["email"] = isEmail
+	v.rules["url"] = isURL
+	v.rules["oneof"] = func(rv reflect.Value, p string) bool {
+		return containsString(strings.Fields(p), fmt.Sprint(rv.Interface()))
+	}
+	v.rules["regex"] = func(rv reflect.Value, p string) bool {
+		// The pattern compiled when the struct's tags were checked
+		re, _ := v.compile(p)
+		return rv.Kind() == reflect.String && re.MatchString(rv.String())
+	}
+
+	// {label} is the field name in words, {param} the rule's parameter.
+	// PHP equivalent: translations/validators.<locale>.yaml
+	v.addMessages("en", map[string]string{
+		"required":   "{label} is required",
+		"min.string": "{label} must be at least {param} characters",
+		"max.string": "{label} must be {param} characters or less",
+		"min.slice":  "{label} must contain at least {param} items",
+		"max.slice":  "{label} must contain {param} items or fewer",
+		"min.number": "{label} must be at least {param}",
+		"max.number": "{label} must be {param} or less",
+		"email":      "Invalid email format",
+		"url":        "{label} must be a valid URL",
+		"oneof":      "{label} must be one of: {param}",
+		"regex":      "{label} has an invalid format",
+		"invalid":    "{label} is invalid",
+	})
+	v.addMessages("fr", map[string]string{
+		"required":   "{label} est obligatoire",
+		"min.string": "{label} doit contenir au moins {param} caractères",
+		"max.string": "{label} doit contenir au plus {param} caractères",
+		"min.slice":  "{label} doit contenir au moins {param} éléments",
+		"max.slice":  "{label} doit contenir au plus {param} éléments",
+		"min.number": "{label} doit être supérieur ou égal à {param}",
+		"max.number": "{label} doit être inférieur ou égal à {param}",
+		"email":      "Format d'adresse e-mail invalide",
+		"url":        "{label} doit être une URL valide",
+		"oneof":      "{label} doit être l'une des valeurs : {param}",
+		"regex":      "{label} n'a pas le bon format",
+		"invalid":    "{label} n'est pas valide",
+	})
+
+	return v
+}
+
+// RegisterRule adds a custom rule, with its message per locale.
+// PHP equivalent: a custom Constraint with its ConstraintValidator
+func (v *Validator) RegisterRule(name string, fn RuleFunc, messages map[string]string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.rules[name] = fn
+	for locale, msg := range messages {
+		if v.messages[locale] == nil {
+			v.messages[locale] = make(map[string]string)
+		}
+		v.messages[locale][name] = msg
+	}
+}
+
+func (v *Validator) addMessages(locale string, messages map[string]string) {
+	v.messages[locale] = messages
+}
+
+// Register parses and checks the validate tags of s, a struct or pointer
+// to one, and of the structs it contains. Registering request types at
+// startup makes a bad tag stop the server instead of failing requests.
+// PHP equivalent: bin/console lint:container checking the constraint attributes
+func (v *Validator) Register(s interface{}) error {
+	t := reflect.TypeOf(s)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("validate: %T is not a struct", s)
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	_, err := v.fields(t)
+	return err
+}
+
+// Struct validates s, a struct or pointer to one, and returns the failures
+// with messages in locale. An empty map means s is valid. It panics if s's
+// type has invalid tags; Register the type at startup to find out sooner.
+func (v *Validator) Struct(s interface{}, locale string) map[string]string {
+	errs := make(map[string]string)
+
+	rv := reflect.ValueOf(s)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return errs
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validate: %T is not a struct", s))
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	v.walkStruct(rv, "", locale, errs)
+	return errs
+}
+
+// Locale picks the best supported language from the Accept-Language header.
+func (v *Validator) Locale(r *http.Request) string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	ranges := httpx.ParseAccept(r.Header.Get("Accept-Language"))
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].Q > ranges[j].Q })
+	for _, lr := range ranges {
+		// "fr-CA" falls back to "fr"
+		lang, _, _ := strings.Cut(lr.Value, "-")
+		if _, ok := v.messages[lang]; ok && lr.Q > 0 {
+			return lang
+		}
+	}
+	return defaultLocale
+}
+
+type rule struct {
+	name  string
+	param string
+}
+
+// fieldRules are the parsed validate tag of one struct field.
+type fieldRules struct {
+	index    int
+	embedded bool // Flattened into the parent, as encoding/json does
+	name     string
+	label    string
+	rules    []rule
+}
+
+// parseTag splits a validate tag into rules; regex= swallows the rest.
+func parseTag(tag string) []rule {
+	var rules []rule
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "regex=") {
+			part, tag = tag, ""
+		} else {
+			part, tag, _ = strings.Cut(tag, ",")
+		}
+		name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name != "" {
+			rules = append(rules, rule{name: name, param: param})
+		}
+	}
+	return rules
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// fields returns t's parsed tags, parsing and checking t and the struct
+// types it contains on first use. The caller holds v.mu.
+func (v *Validator) fields(t reflect.Type) ([]fieldRules, error) {
+	if fields, ok := v.structs.Load(t); ok {
+		return fields.([]fieldRules), nil
+	}
+	if err := v.parseStruct(t, make(map[reflect.Type]bool)); err != nil {
+		return nil, err
+	}
+	fields, _ := v.structs.Load(t)
+	return fields.([]fieldRules), nil
+}
+
+// parseStruct parses the tags of t's fields and of the struct types they
+// hold, storing each type's fields. seen stops recursive types looping.
+func (v *Validator) parseStruct(t reflect.Type, seen map[reflect.Type]bool) error {
+	if _, ok := v.structs.Load(t); ok || seen[t] {
+		return nil
+	}
+	seen[t] = true
+
+	var fields []fieldRules
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && f.Tag.Get("json") == "" && ft.Kind() == reflect.Struct {
+			if err := v.parseStruct(ft, seen); err != nil {
+				return err
+			}
+			fields = append(fields, fieldRules{index: i, embedded: true})
+			continue
+		}
+		name := jsonName(f)
+		if name == "-" {
+			continue
+		}
+
+		rules := parseTag(f.Tag.Get("validate"))
+		if err := v.checkRules(rules); err != nil {
+			return fmt.Errorf("validate: %s.%s: %w", t, f.Name, err)
+		}
+		fields = append(fields, fieldRules{index: i, name: name, label: labelFor(name), rules: rules})
+
+		for ft.Kind() == reflect.Pointer || ft.Kind() == reflect.Slice || ft.Kind() == reflect.Array {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && ft != timeType {
+			if err := v.parseStruct(ft, seen); err != nil {
+				return err
+			}
+		}
+	}
+
+	v.structs.Store(t, fields)
+	return nil
+}
+
+// checkRules reports the first rule that could never be applied.
+func (v *Validator) checkRules(rules []rule) error {
+	for _, r := range rules {
+		if r.name == "dive" {
+			continue
+		}
+		if _, ok := v.rules[r.name]; !ok {
+			return fmt.Errorf("unknown rule %q", r.name)
+		}
+		switch r.name {
+		case "min", "max":
+			if _, err := strconv.ParseFloat(r.param, 64); err != nil {
+				return fmt.Errorf("%s needs a number, got %q", r.name, r.param)
+			}
+		case "regex":
+			if _, err := v.compile(r.param); err != nil {
+				return fmt.Errorf("regex: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (v *Validator) walkStruct(rv reflect.Value, prefix, locale string, errs map[string]string) {
+	fields, err := v.fields(rv.Type())
+	if err != nil {
+		panic(err.Error())
+	}
+	for _, f := range fields {
+		if f.embedded {
+			// A nil embedded pointer has nothing to check
+			if embedded := reflect.Indirect(rv.Field(f.index)); embedded.IsValid() {
+				v.walkStruct(embedded, prefix, locale, errs)
+			}
+			continue
+		}
+		path := f.name
+		if prefix != "" {
+			path = prefix + "." + f.name
+		}
+		v.walkValue(rv.Field(f.index), f.rules, path, f.label, locale, errs)
+	}
+}
+
+// walkValue applies rules to one value, then descends into structs and slices.
+func (v *Validator) walkValue(rv reflect.Value, rules []rule, path, label, locale string, errs map[string]string) {
+	var elemRules []rule
+	for i, r := range rules {
+		if r.name == "dive" {
+			elemRules = rules[i+1:]
+			rules = rules[:i]
+			break
+		}
+	}
+
+	empty := isEmpty(rv)
+	for _, r := range rules {
+		// Optional fields are only checked when present
+		if empty && r.name != "required" {
+			continue
+		}
+		if !v.rules[r.name](rv, r.param) {
+			errs[path] = v.message(locale, r, rv, label)
+			return
+		}
+	}
+	if empty {
+		return
+	}
+
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		rv = rv.Elem()
+	}
+	switch {
+	case rv.Kind() == reflect.Struct && rv.Type() != timeType:
+		v.walkStruct(rv, path, locale, errs)
+	case rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			v.walkValue(rv.Index(i), elemRules, fmt.Sprintf("%s[%d]", path, i), label, locale, errs)
+		}
+	}
+}
+
+// message renders the message for a failed rule, falling back to English
+// and then to a generic message.
+func (v *Validator) message(locale string, r rule, rv reflect.Value, label string) string {
+	key := r.name
+	if r.name == "min" || r.name == "max" {
+		key += "." + sizeKind(rv)
+	}
+
+	tmpl, ok := v.messages[locale][key]
+	if !ok {
+		tmpl, ok = v.messages[defaultLocale][key]
+	}
+	if !ok {
+		tmpl = v.messages[defaultLocale]["invalid"]
+	}
+
+	param := r.param
+	if r.name == "oneof" {
+		param = strings.Join(strings.Fields(param), ", ")
+	}
+	return strings.NewReplacer("{label}", label, "{param}", param).Replace(tmpl)
+}
+
+func (v *Validator) compile(pattern string) (*regexp.Regexp, error) {
+	if re, ok := v.regexps.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	v.regexps.Store(pattern, re)
+	return re, nil
+}
+
+// --- Built-in rule helpers ---
+
+func isEmpty(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(rv.String()) == ""
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	case reflect.Slice, reflect.Map:
+		return rv.Len() == 0
+	case reflect.Invalid:
+		return true
+	}
+	return rv.IsZero()
+}
+
+// sizeKind names how min/max measure a value, for picking a message.
+func sizeKind(rv reflect.Value) string {
+	for rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return "slice"
+	}
+	return "number"
+}
+
+// compareSize measures strings in characters, collections by length and
+// numbers by value, then compares against the rule's limit.
+func compareSize(rv reflect.Value, param string, ok func(n, limit float64) bool) bool {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return false
+	}
+	for rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+
+	var n float64
+	switch rv.Kind() {
+	case reflect.String:
+		n = float64(utf8.RuneCountInString(rv.String()))
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n = float64(rv.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = rv.Float()
+	default:
+		return false
+	}
+	return ok(n, limit)
+}
+
+// isEmail accepts a bare address with a dotted domain, unlike
+// strings.Contains(s, "@"), and rejects display names like "Bob <b@x.com>".
+// PHP equivalent: #[Assert\Email(mode: 'html5')]
+func isEmail(rv reflect.Value, _ string) bool {
+	if rv.Kind() != reflect.String {
+		return false
+	}
+	s := rv.String()
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s {
+		return false
+	}
+	_, domain, _ := strings.Cut(s, "@")
+	return strings.Contains(domain, ".") && !strings.HasSuffix(domain, ".")
+}
+
+// isURL accepts absolute http and https URLs with a host.
+// PHP equivalent: #[Assert\Url]
+func isURL(rv reflect.Value, _ string) bool {
+	if rv.Kind() != reflect.String {
+		return false
+	}
+	u, err := url.Parse(rv.String())
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// jsonName is the field's name in the request body.
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// labelFor turns a JSON name into words for messages: "refresh_token" -> "Refresh token".
+func labelFor(name string) string {
+	label := strings.ReplaceAll(name, "_", " ")
+	if label == "" {
+		return label
+	}
+	return strings.ToUpper(label[:1]) + label[1:]
+}
+
+// validRequest validates a decoded request body and, if it is invalid,
+// writes a 422 in the client's language. It reports whether to carry on.
+// PHP equivalent: #[MapRequestPayload] throwing a ValidationFailedException
+func validRequest(w http.ResponseWriter, r *http.Request, req interface{}) bool {
+	errs := validate.Struct(req, validate.Locale(r))
+	if len(errs) == 0 {
+		return true
+	}
+	writeValidationError(w, r, errs)
+	return false
+}
+
+// registerRequestTypes checks the validate tags of every request body in
+// routeDocs, so that a bad tag stops the server at startup.
+func registerRequestTypes() error {
+	for pattern, doc := range routeDocs {
+		if doc.Request == nil {
+			continue
+		}
+		if err := validate.Register(doc.Request); err != nil {
+			return fmt.Errorf("%s: %w", pattern, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testAddress struct {
+	City     string `json:"city" validate:"required"`
+	Postcode string `json:"postcode" validate:"regex=^[0-9]{5}$"`
+}
+
+type testProfile struct {
+	Name      string        `json:"name" validate:"required,max=5"`
+	Email     string        `json:"email" validate:"email"`
+	Website   string        `json:"website" validate:"url"`
+	Role      string        `json:"role" validate:"oneof=admin user"`
+	Age       int           `json:"age" validate:"min=18,max=130"`
+	Tags      []string      `json:"tags" validate:"max=2,dive,min=2"`
+	Address   testAddress   `json:"address"`
+	Previous  *testAddress  `json:"previous"`
+	Others    []testAddress `json:"others"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+func TestValidatorRules(t *testing.T) {
+	v := NewValidator()
+	valid := func() testProfile {
+		return testProfile{
+			Name: "Alice", Email: "alice@example.com", Website: "https://example.com",
+			Role: "admin", Age: 30, Tags: []string{"go", "php"},
+			Address: testAddress{City: "Paris", Postcode: "75001"},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(p *testProfile)
+		want   map[string]string
+	}{
+		{"valid", func(p *testProfile) {}, map[string]string{}},
+		{"optional fields empty", func(p *testProfile) {
+			p.Email, p.Website, p.Role, p.Age, p.Tags = "", "", "", 0, nil
+		}, map[string]string{}},
+		{"required", func(p *testProfile) { p.Name = "  " }, map[string]string{"name": "Name is required"}},
+		{"max counts characters", func(p *testProfile) { p.Name = "Zoë" }, map[string]string{}},
+		{"max string", func(p *testProfile) { p.Name = "Alexandra" }, map[string]string{"name": "Name must be 5 characters or less"}},
+		{"email", func(p *testProfile) { p.Email = "alice@" }, map[string]string{"email": "Invalid email format"}},
+		{"email without dotted domain", func(p *testProfile) { p.Email = "alice@localhost" }, map[string]string{"email": "Invalid email format"}},
+		{"email with display name", func(p *testProfile) { p.Email = "Alice <alice@example.com>" }, map[string]string{"email": "Invalid email format"}},
+		{"url", func(p *testProfile) { p.Website = "ftp://example.com" }, map[string]string{"website": "Website must be a valid URL"}},
+		{"oneof", func(p *testProfile) { p.Role = "root" }, map[string]string{"role": "Role must be one of: admin, user"}},
+		{"min number", func(p *testProfile) { p.Age = 12 }, map[string]string{"age": "Age must be at least 18"}},
+		{"max slice", func(p *testProfile) { p.Tags = []string{"a1", "b1", "c1"} }, map[string]string{"tags": "Tags must contain 2 items or fewer"}},
+		{"dive", func(p *testProfile) { p.Tags = []string{"go", "x"} }, map[string]string{"tags[1]": "Tags must be at least 2 characters"}},
+		{"nested struct", func(p *testProfile) { p.Address.City = "" }, map[string]string{"address.city": "City is required"}},
+		{"regex", func(p *testProfile) { p.Address.Postcode = "7500A" }, map[string]string{"address.postcode": "Postcode has an invalid format"}},
+		{"nested pointer", func(p *testProfile) { p.Previous = &testAddress{} }, map[string]string{"previous.city": "City is required"}},
+		{"slice of structs", func(p *testProfile) {
+			p.Others = []testAddress{{City: "Lyon"}, {Postcode: "1"}}
+		}, map[string]string{"others[1].city": "City is required", "others[1].postcode": "Postcode has an invalid format"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid()
+			tt.modify(&p)
+			if got := v.Struct(&p, "en"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Struct() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatorCustomRule(t *testing.T) {
+	v := NewValidator()
+	v.RegisterRule("even", func(rv reflect.Value, _ string) bool { return rv.Int()%2 == 0 }, map[string]string{
+		"en": "{label} must be even",
+	})
+
+	type request struct {
+		Count int `json:"item_count" validate:"even"`
+	}
+
+	if errs := v.Struct(request{Count: 4}, "en"); len(errs) != 0 {
+		t.Errorf("Expected no errors, got %v", errs)
+	}
+	// No French message: falls back to English
+	want := map[string]string{"item_count": "Item count must be even"}
+	if errs := v.Struct(request{Count: 3}, "fr"); !reflect.DeepEqual(errs, want) {
+		t.Errorf("Struct() = %v, want %v", errs, want)
+	}
+}
+
+// TestValidatorRegister tests that tags that could never pass are found
+// when the type is registered, not when a request arrives.
+func TestValidatorRegister(t *testing.T) {
+	type unknownRule struct {
+		Email string `json:"email" validate:"required,emial"`
+	}
+	type badRegex struct {
+		Code string `json:"code" validate:"regex=^[A-Z+$"`
+	}
+	type badLimit struct {
+		Name string `json:"name" validate:"max=ten"`
+	}
+	type badElement struct {
+		Tags []string `json:"tags" validate:"dive,nonempty"`
+	}
+	type badNested struct {
+		Items []struct {
+			SKU string `json:"sku" validate:"regex=("`
+		} `json:"items"`
+	}
+
+	tests := []struct {
+		name string
+		s    interface{}
+		want string // Expected in the error
+	}{
+		{"unknown rule", unknownRule{}, `unknownRule.Email: unknown rule "emial"`},
+		{"regex that does not compile", badRegex{}, "badRegex.Code: regex: error parsing regexp"},
+		{"max that is not a number", &badLimit{}, `badLimit.Name: max needs a number, got "ten"`},
+		{"unknown rule after dive", badElement{}, `badElement.Tags: unknown rule "nonempty"`},
+		{"nested struct", badNested{}, `.SKU: regex`},
+		{"not a struct", "name", "not a struct"},
+	}
+
+	v := NewValidator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Register(tt.s)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Register = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+
+	if err := v.Register(&testProfile{}); err != nil {
+		t.Errorf("Register(testProfile) = %v", err)
+	}
+
+	// An unregistered bad type still fails loudly on first use
+	defer func() {
+		if recover() == nil {
+			t.Error("Struct with an unknown rule did not panic")
+		}
+	}()
+	v.Struct(unknownRule{Email: "a@example.com"}, "en")
+}
+
+// TestRequestTypesRegister tests every request body the API validates, as
+// main does at startup.
+func TestRequestTypesRegister(t *testing.T) {
+	if err := registerRequestTypes(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidatorLocale(t *testing.T) {
+	v := NewValidator()
+
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"fr", "fr"},
+		{"fr-CA, en;q=0.8", "fr"},
+		{"de, fr;q=0.5, en;q=0.9", "en"},
+		{"de", "en"},
+		{"fr;q=0", "en"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/users", nil)
+		if tt.header != "" {
+			r.Header.Set("Accept-Language", tt.header)
+		}
+		if got := v.Locale(r); got != tt.want {
+			t.Errorf("Locale(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+// TestCreateUserValidation tests that validation failures are localised
+// and keep the {field: message} shape in the error body.
+func TestCreateUserValidation(t *testing.T) {
+	api := NewAPI(NewUserStore(), nil, newTestHasher(t), NewAPIKeyStore())
+
+	req := httptest.NewRequest("POST", "/users", strings.NewReader(`{"name":"Bob","email":"bob","password":"short"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept-Language", "fr-FR")
+	rec := httptest.NewRecorder()
+	api.CreateUser(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422: %s", rec.Code, rec.Body)
+	}
+	var apiErr APIError
+	decodeBody(t, rec, &apiErr)
+	want := map[string]interface{}{
+		"email":    "Format d'adresse e-mail invalide",
+		"password": "Password doit contenir au moins 8 caractères",
+	}
+	if got := apiErr.Extensions["errors"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("errors = %v, want %v", got, want)
+	}
+}
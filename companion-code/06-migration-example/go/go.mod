@@ -2,4 +2,10 @@ module github.com/Dr-H-PhD/recompiling-your-mind-code/06-migration-example
 
 go 1.22
 
-require github.com/lib/pq v1.10.9
+require (
+	github.com/Dr-H-PhD/recompiling-your-mind-code/internal v0.0.0
+	github.com/lib/pq v1.10.9
+)
+
+// The helpers shared by every example live in ../../internal
+replace github.com/Dr-H-PhD/recompiling-your-mind-code/internal => ../../internal
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// idempotencyPrincipal scopes Idempotency-Key entries to the caller. The
+// PHP app and this service share JWT_SECRET, so the bearer token is
+// verified and its subject used: a client that refreshes its token between
+// retries keeps its scope and gets the first response back. Requests
+// without a valid token share the anonymous scope, whose keys must be
+// unguessable, as in the REST API example.
+func idempotencyPrincipal(secret []byte) func(*http.Request) string {
+	return func(r *http.Request) string {
+		if sub, ok := tokenSubject(r.Header.Get("Authorization"), secret, time.Now()); ok {
+			return "user:" + sub
+		}
+		return "anonymous"
+	}
+}
+
+// tokenSubject returns the "sub" claim of a valid, unexpired HS256 bearer
+// token signed with secret.
+// PHP equivalent: $jwtManager->parse($token)['sub'] with LexikJWTAuthenticationBundle
+func tokenSubject(authorization string, secret []byte, now time.Time) (string, bool) {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return "", false
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if !decodeSegment(parts[0], &header) || header.Alg != "HS256" {
+		return "", false
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, mac.Sum(nil)) {
+		return "", false
+	}
+
+	var claims struct {
+		Subject   string `json:"sub"`
+		ExpiresAt int64  `json:"exp"`
+	}
+	if !decodeSegment(parts[1], &claims) || claims.Subject == "" || now.Unix() >= claims.ExpiresAt {
+		return "", false
+	}
+	return claims.Subject, true
+}
+
+// decodeSegment decodes one base64url JSON part of a token into v.
+func decodeSegment(segment string, v interface{}) bool {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	return err == nil && json.Unmarshal(b, v) == nil
+}
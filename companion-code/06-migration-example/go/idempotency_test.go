@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/httpx"
+)
+
+var testSecret = []byte("test-secret-shared-with-the-php-app")
+
+// signToken returns an HS256 token with the given claims JSON.
+func signToken(secret []byte, claims string) string {
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestTokenSubject(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	valid := signToken(testSecret, `{"sub":"42","iat":1699999000,"exp":1700003600}`)
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          string
+	}{
+		{"valid", "Bearer " + valid, "42"},
+		{"no scheme", valid, ""},
+		{"wrong secret", "Bearer " + signToken([]byte("other"), `{"sub":"42","exp":1700003600}`), ""},
+		{"tampered", "Bearer " + strings.Replace(valid, ".", ".e30", 1), ""},
+		{"expired", "Bearer " + signToken(testSecret, `{"sub":"42","exp":1699999999}`), ""},
+		{"no expiry", "Bearer " + signToken(testSecret, `{"sub":"42"}`), ""},
+		{"no subject", "Bearer " + signToken(testSecret, `{"exp":1700003600}`), ""},
+	}
+	for _, tt := range tests {
+		got, ok := tokenSubject(tt.authorization, testSecret, now)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s: tokenSubject = %q, %v; want %q", tt.name, got, ok, tt.want)
+		}
+	}
+}
+
+// TestIdempotencyAcrossTokenRefresh checks that a client retrying with a
+// refreshed token gets the first response instead of a second user.
+func TestIdempotencyAcrossTokenRefresh(t *testing.T) {
+	calls := 0
+	h := httpx.IdempotencyMiddleware(httpx.NewMemoryIdempotencyStore(time.Hour), idempotencyPrincipal(testSecret))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusCreated)
+		}),
+	)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	post := func(claims string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v2/users", strings.NewReader(`{"name":"Alice"}`))
+		req.Header.Set("Authorization", "Bearer "+signToken(testSecret, claims))
+		req.Header.Set("Idempotency-Key", "0190a0b2-6c4e-7d2a-9f3e-1a2b3c4d5e6f")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	post(`{"sub":"42","jti":"first","exp":` + itoa(exp) + `}`)
+	retry := post(`{"sub":"42","jti":"refreshed","exp":` + itoa(exp+60) + `}`)
+	if calls != 1 || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry with a refreshed token ran the handler again (%d calls)", calls)
+	}
+
+	// Another user's identical request is their own
+	post(`{"sub":"43","exp":` + itoa(exp) + `}`)
+	if calls != 2 {
+		t.Errorf("another user's request was replayed")
+	}
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
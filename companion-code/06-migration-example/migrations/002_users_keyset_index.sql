@@ -0,0 +1,6 @@
+-- Indexes for keyset pagination of /api/v2/users
+-- Each matches ORDER BY <column>, id, so a page is one index range scan
+
+CREATE INDEX IF NOT EXISTS idx_users_created_at_id ON users(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_users_name_id ON users(name COLLATE "C", id);
+CREATE INDEX IF NOT EXISTS idx_users_email_id ON users(email COLLATE "C", id);
@@ -0,0 +1,4 @@
+-- Emails are unique regardless of case, as in the Go services' checks.
+-- The UNIQUE constraint on email alone lets Alice@x.com and alice@x.com coexist.
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users(lower(email));
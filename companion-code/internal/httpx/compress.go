@@ -0,0 +1,290 @@
+package httpx
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// CompressionConfig controls which responses are compressed.
+// PHP equivalent: nginx's gzip_min_length and gzip_types directives
+type CompressionConfig struct {
+	// MinSize is the smallest body, in bytes, worth compressing.
+	MinSize int
+	// ContentTypes lists compressible media types; "text/" style prefixes match a whole family.
+	ContentTypes []string
+}
+
+// DefaultCompressionConfig compresses text-like bodies of 1 KiB or more.
+func DefaultCompressionConfig() CompressionConfig {
+	return CompressionConfig{
+		MinSize: 1024,
+		ContentTypes: []string{
+			"application/json",
+			"application/problem+json",
+			"application/xml",
+			"application/msgpack",
+			"text/",
+		},
+	}
+}
+
+// allows reports whether a Content-Type is on the allow-list.
+func (c CompressionConfig) allows(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range c.ContentTypes {
+		if mediaType == allowed || (strings.HasSuffix(allowed, "/") && strings.HasPrefix(mediaType, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Encoders are pooled: allocating a gzip.Writer costs hundreds of KiB.
+var (
+	gzipPool = sync.Pool{New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}}
+	// HTTP's "deflate" coding is zlib-wrapped (RFC 9110), not raw DEFLATE
+	zlibPool = sync.Pool{New: func() interface{} {
+		return zlib.NewWriter(nil)
+	}}
+)
+
+// CompressMiddleware compresses responses with gzip or deflate according to
+// Accept-Encoding. Bodies are buffered until MinSize bytes so small responses
+// go out untouched with their Content-Length intact.
+//
+// A compressed body is a different representation, so it must not carry the
+// identity body's strong ETag: the coding is appended to it ("abc" becomes
+// "abc-gzip"), and removed again from If-Match and If-None-Match so handlers
+// only ever compare identity tags.
+// PHP equivalent: zlib.output_compression, or gzip on; in nginx
+func CompressMiddleware(cfg CompressionConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The representation depends on Accept-Encoding, compressed or not
+			addVary(w.Header(), "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+
+			stripETagCodings(r.Header, "If-Match")
+			// A 304 must repeat the tag the client cached
+			cachedEncoded := stripETagCodings(r.Header, "If-None-Match")
+
+			// Byte ranges refer to the uncompressed body, and HEAD has no body
+			if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, cfg: cfg, encoding: encoding, cachedEncoded: cachedEncoded[encoding]}
+			defer cw.close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding picks gzip or deflate from Accept-Encoding, or "" for identity.
+// On equal q-values gzip wins as the more widely supported format.
+func negotiateEncoding(header string) string {
+	qs := make(map[string]float64)
+	star := -1.0
+	for _, e := range ParseAccept(header) {
+		if e.Value == "*" {
+			star = e.Q
+		} else {
+			qs[e.Value] = e.Q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range []string{"gzip", "deflate"} {
+		q, ok := qs[enc]
+		if !ok {
+			if star < 0 {
+				continue
+			}
+			q = star
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the start of the body to decide whether to compress.
+type compressWriter struct {
+	http.ResponseWriter
+	cfg      CompressionConfig
+	encoding string
+	// cachedEncoded is set when If-None-Match named a tag in this encoding
+	cachedEncoded bool
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     io.WriteCloser // nil when passing the body through
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	// Informational responses such as 103 Early Hints precede the real one,
+	// so they go out as they are and leave the final status to come
+	if status >= 100 && status < 200 {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if cw.status != 0 {
+		return
+	}
+	cw.status = status
+
+	if status == http.StatusNotModified && cw.cachedEncoded {
+		cw.encodeETag()
+	}
+
+	// Nothing to compress: commit the headers straight away
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.cfg.MinSize {
+			return len(b), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// decide commits the headers, choosing compression only when the buffered
+// body reached MinSize and the content type is on the allow-list.
+func (cw *compressWriter) decide(bigEnough bool) error {
+	cw.decided = true
+	h := cw.Header()
+
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	if bigEnough && h.Get("Content-Encoding") == "" && cw.cfg.allows(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length") // The compressed length is unknown until the end
+		cw.encodeETag()
+		cw.enc = newEncoder(cw.encoding, cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.enc != nil {
+		_, err := cw.enc.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// encodeETag appends the encoding to the ETag, if there is one.
+func (cw *compressWriter) encodeETag() {
+	if tag := cw.Header().Get("ETag"); strings.HasSuffix(tag, `"`) {
+		cw.Header().Set("ETag", strings.TrimSuffix(tag, `"`)+"-"+cw.encoding+`"`)
+	}
+}
+
+// stripETagCodings removes the encodings encodeETag adds from the tags in
+// a conditional header, and reports which encodings it found.
+func stripETagCodings(h http.Header, name string) map[string]bool {
+	value := h.Get(name)
+	if value == "" || strings.TrimSpace(value) == "*" {
+		return nil
+	}
+
+	found := make(map[string]bool)
+	tags := strings.Split(value, ",")
+	for i, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		for _, enc := range []string{"gzip", "deflate"} {
+			if suffix := "-" + enc + `"`; strings.HasSuffix(tag, suffix) {
+				tag = strings.TrimSuffix(tag, suffix) + `"`
+				found[enc] = true
+			}
+		}
+		tags[i] = tag
+	}
+	h.Set(name, strings.Join(tags, ", "))
+	return found
+}
+
+// Flush sends whatever is buffered, so streaming handlers keep working.
+func (cw *compressWriter) Flush() {
+	if !cw.decided && cw.status != 0 {
+		cw.decide(len(cw.buf) >= cw.cfg.MinSize)
+	}
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close finishes the response once the handler has returned.
+func (cw *compressWriter) close() {
+	if !cw.decided && cw.status != 0 {
+		cw.decide(false) // Smaller than MinSize: send as-is
+	}
+	if cw.enc == nil {
+		return
+	}
+
+	cw.enc.Close()
+	switch enc := cw.enc.(type) {
+	case *gzip.Writer:
+		gzipPool.Put(enc)
+	case *zlib.Writer:
+		zlibPool.Put(enc)
+	}
+}
+
+// newEncoder takes a pooled encoder and points it at w.
+func newEncoder(encoding string, w io.Writer) io.WriteCloser {
+	if encoding == "gzip" {
+		gz := gzipPool.Get().(*gzip.Writer)
+		gz.Reset(w)
+		return gz
+	}
+	zw := zlibPool.Get().(*zlib.Writer)
+	zw.Reset(w)
+	return zw
+}
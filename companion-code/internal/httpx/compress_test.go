@@ -0,0 +1,252 @@
+package httpx
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestNegotiateEncoding tests Accept-Encoding parsing.
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"gzip, deflate, br", "gzip"},
+		{"deflate;q=1, gzip;q=0.5", "deflate"},
+		{"gzip;q=0, deflate", "deflate"},
+		{"*", "gzip"},
+		{"br", ""},
+		{"identity", ""},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.header); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+// TestCompressMiddleware tests when responses are and are not compressed.
+// PHP equivalent: checking nginx gzip settings with curl -H 'Accept-Encoding: gzip'
+func TestCompressMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"name": "Alice"},`, 200)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		wantEncoding   string
+	}{
+		{"gzip large json", "gzip", "application/json", large, "gzip"},
+		{"deflate large json", "deflate", "application/json", large, "deflate"},
+		{"below min size", "gzip", "application/json", `{"ok": true}`, ""},
+		{"type not allowed", "gzip", "image/png", large, ""},
+		{"client does not accept", "", "application/json", large, ""},
+		{"csv list", "gzip", "text/csv; charset=utf-8", large, "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := CompressMiddleware(DefaultCompressionConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Header().Set("Content-Length", strconv.Itoa(len(tt.body)))
+				// Several small writes, like an encoder would make
+				for i := 0; i < len(tt.body); i += 100 {
+					end := i + 100
+					if end > len(tt.body) {
+						end = len(tt.body)
+					}
+					w.Write([]byte(tt.body[i:end]))
+				}
+			}))
+
+			req := httptest.NewRequest("GET", "/users", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Expected Content-Encoding %q, got %q", tt.wantEncoding, got)
+			}
+			if w.Header().Get("Vary") != "Accept-Encoding" {
+				t.Error("Expected Vary: Accept-Encoding")
+			}
+
+			var body io.Reader = w.Body
+			switch tt.wantEncoding {
+			case "gzip":
+				body, _ = gzip.NewReader(w.Body)
+			case "deflate":
+				body, _ = zlib.NewReader(w.Body)
+			}
+
+			if tt.wantEncoding != "" && w.Header().Get("Content-Length") != "" {
+				t.Error("Expected Content-Length to be removed from a compressed response")
+			}
+			if tt.wantEncoding == "" && w.Header().Get("Content-Length") != strconv.Itoa(len(tt.body)) {
+				t.Error("Expected Content-Length to be kept on an uncompressed response")
+			}
+
+			decoded, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("Failed to read body: %v", err)
+			}
+			if string(decoded) != tt.body {
+				t.Error("Decoded body does not match the original")
+			}
+		})
+	}
+}
+
+// TestCompressMiddlewareStatus tests that status codes survive buffering.
+func TestCompressMiddlewareStatus(t *testing.T) {
+	handler := CompressMiddleware(DefaultCompressionConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest("DELETE", "/users/1", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", w.Code)
+	}
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Error("Expected no Content-Encoding on an empty response")
+	}
+}
+
+// TestCompressMiddlewareEarlyHints tests that a 103 Early Hints response
+// goes out on its own and the final 200 is still compressed.
+func TestCompressMiddlewareEarlyHints(t *testing.T) {
+	body := strings.Repeat(`{"name":"Alice"}`, 100)
+	handler := CompressMiddleware(DefaultCompressionConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, body)
+	}))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	var hints []int
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			hints = append(hints, code)
+			return nil
+		},
+	}
+	req, _ := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), "GET", srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	// Without DisableCompression the transport would hide Content-Encoding
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if len(hints) != 1 || hints[0] != http.StatusEarlyHints {
+		t.Errorf("Expected one 103 response, got %v", hints)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected final status 200, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected a gzip body, got Content-Encoding %q", resp.Header.Get("Content-Encoding"))
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	if got, _ := io.ReadAll(gz); string(got) != body {
+		t.Error("Decompressed body does not match")
+	}
+}
+
+// TestCompressMiddlewareETag tests CompressMiddleware in front of a handler
+// using NotModified and CheckIfMatch: a compressed body gets its own strong
+// ETag, and that tag still works in conditional requests.
+func TestCompressMiddlewareETag(t *testing.T) {
+	resource := map[string]string{"bio": strings.Repeat("x", 2048)}
+	identity := ETag(resource)
+	gzipped := strings.TrimSuffix(identity, `"`) + `-gzip"`
+
+	handler := CompressMiddleware(DefaultCompressionConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			if err := CheckIfMatch(r, resource); err != nil {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if NotModified(w, r, ETag(resource), time.Time{}) {
+			return
+		}
+		Render(w, r, http.StatusOK, resource)
+	}))
+
+	tests := []struct {
+		name           string
+		method         string
+		acceptEncoding string
+		header         string
+		value          string
+		wantStatus     int
+		wantETag       string
+	}{
+		{"identity keeps the tag", "GET", "", "", "", http.StatusOK, identity},
+		{"gzip gets its own tag", "GET", "gzip", "", "", http.StatusOK, gzipped},
+		{"revalidate gzip copy", "GET", "gzip", "If-None-Match", gzipped, http.StatusNotModified, gzipped},
+		{"revalidate identity copy", "GET", "", "If-None-Match", identity, http.StatusNotModified, identity},
+		{"stale gzip copy", "GET", "gzip", "If-None-Match", `"stale-gzip"`, http.StatusOK, gzipped},
+		{"update with gzip tag", "PUT", "gzip", "If-Match", gzipped, http.StatusNoContent, ""},
+		{"update with identity tag", "PUT", "", "If-Match", identity, http.StatusNoContent, ""},
+		{"update with stale tag", "PUT", "gzip", "If-Match", `"stale-gzip"`, http.StatusPreconditionFailed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/users/1", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Header().Get("ETag"); got != tt.wantETag {
+				t.Errorf("Expected ETag %s, got %s", tt.wantETag, got)
+			}
+		})
+	}
+}
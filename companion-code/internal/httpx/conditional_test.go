@@ -0,0 +1,100 @@
+package httpx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestEtagMatches tests strong and weak ETag comparison.
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		tag    string
+		weak   bool
+		want   bool
+	}{
+		{`"abc"`, `"abc"`, false, true},
+		{`"xyz", "abc"`, `"abc"`, false, true},
+		{`W/"abc"`, `"abc"`, true, true},
+		{`W/"abc"`, `"abc"`, false, false},
+		{`*`, `"abc"`, false, true},
+		{`"xyz"`, `"abc"`, true, false},
+	}
+
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, tt.tag, tt.weak); got != tt.want {
+			t.Errorf("etagMatches(%q, %q, %t) = %t, want %t", tt.header, tt.tag, tt.weak, got, tt.want)
+		}
+	}
+}
+
+// TestNotModified tests 304 responses for If-None-Match and If-Modified-Since.
+// PHP equivalent: asserting $response->isNotModified($request)
+func TestNotModified(t *testing.T) {
+	tag := ETag(map[string]int{"id": 1})
+	lastModified := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		method string
+		header string
+		value  string
+		want   bool
+	}{
+		{"no validators", "GET", "", "", false},
+		{"matching etag", "GET", "If-None-Match", tag, true},
+		{"weak matching etag", "GET", "If-None-Match", "W/" + tag, true},
+		{"stale etag", "GET", "If-None-Match", `"stale"`, false},
+		{"not modified since", "GET", "If-Modified-Since", lastModified.Format(http.TimeFormat), true},
+		{"modified since", "GET", "If-Modified-Since", lastModified.Add(-time.Hour).Format(http.TimeFormat), false},
+		{"unsafe method", "PUT", "If-None-Match", tag, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/users/1", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+
+			if got := NotModified(w, req, tag, lastModified); got != tt.want {
+				t.Fatalf("NotModified = %t, want %t", got, tt.want)
+			}
+			if w.Header().Get("ETag") != tag || w.Header().Get("Last-Modified") == "" {
+				t.Errorf("Expected validators, got %v", w.Header())
+			}
+			if tt.want && w.Code != http.StatusNotModified {
+				t.Errorf("Expected status 304, got %d", w.Code)
+			}
+		})
+	}
+}
+
+// TestCheckIfMatch tests optimistic concurrency with If-Match.
+func TestCheckIfMatch(t *testing.T) {
+	current := map[string]string{"name": "Alice"}
+
+	tests := []struct {
+		ifMatch string
+		want    error
+	}{
+		{"", nil},
+		{ETag(current), nil},
+		{"*", nil},
+		{`"stale"`, ErrPreconditionFailed},
+		{"W/" + ETag(current), ErrPreconditionFailed}, // Strong comparison
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("PATCH", "/users/1", nil)
+		if tt.ifMatch != "" {
+			req.Header.Set("If-Match", tt.ifMatch)
+		}
+		if err := CheckIfMatch(req, current); err != tt.want {
+			t.Errorf("If-Match %q: err = %v, want %v", tt.ifMatch, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package httpx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// MaxBodyBytes caps request bodies at 1 MiB.
+// PHP equivalent: post_max_size in php.ini
+const MaxBodyBytes = 1 << 20
+
+// DecodeError describes why a request body was rejected.
+// Field is the JSON path of the offending value, empty if the whole body is at fault.
+type DecodeError struct {
+	Status  int
+	Field   string
+	Message string
+}
+
+func (e *DecodeError) Error() string {
+	if e.Field != "" {
+		return e.Field + ": " + e.Message
+	}
+	return e.Message
+}
+
+// DecodeJSON strictly decodes a JSON request body into dst.
+// It requires a JSON Content-Type, enforces MaxBodyBytes, and rejects
+// unknown fields and anything after the first JSON value.
+// Errors are *DecodeError values carrying the HTTP status to return.
+// PHP equivalent: $serializer->deserialize() with ALLOW_EXTRA_ATTRIBUTES => false
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		return &DecodeError{
+			Status:  http.StatusUnsupportedMediaType,
+			Message: "Content-Type must be application/json",
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		return TranslateDecodeError(err)
+	}
+
+	// A second Decode must hit EOF, otherwise there is trailing data
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return TranslateDecodeError(err)
+		}
+		return &DecodeError{
+			Status:  http.StatusBadRequest,
+			Message: "Request body must contain a single JSON value",
+		}
+	}
+
+	return nil
+}
+
+// TranslateDecodeError turns encoding/json errors into client-facing messages.
+func TranslateDecodeError(err error) *DecodeError {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		maxErr    *http.MaxBytesError
+	)
+
+	switch {
+	case errors.As(err, &maxErr):
+		return &DecodeError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("Request body must not exceed %d bytes", maxErr.Limit),
+		}
+	case errors.As(err, &syntaxErr):
+		return &DecodeError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("Malformed JSON at position %d", syntaxErr.Offset),
+		}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &DecodeError{Status: http.StatusBadRequest, Message: "Malformed JSON"}
+	case errors.As(err, &typeErr):
+		return &DecodeError{
+			Status:  http.StatusBadRequest,
+			Field:   typeErr.Field,
+			Message: "Must be " + jsonTypeName(typeErr.Type),
+		}
+	case errors.Is(err, io.EOF):
+		return &DecodeError{Status: http.StatusBadRequest, Message: "Request body must not be empty"}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for this one
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &DecodeError{Status: http.StatusBadRequest, Field: field, Message: "Unknown field"}
+	}
+
+	return &DecodeError{Status: http.StatusBadRequest, Message: "Invalid JSON"}
+}
+
+// jsonTypeName describes a Go type in JSON terms for error messages.
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
+
+// WriteDecodeError renders a decoding failure as a problem,
+// naming the offending field under "errors" when it is known.
+func WriteDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		de = &DecodeError{Status: http.StatusBadRequest, Message: "Invalid JSON"}
+	}
+
+	code := "INVALID_JSON"
+	switch de.Status {
+	case http.StatusRequestEntityTooLarge:
+		code = "PAYLOAD_TOO_LARGE"
+	case http.StatusUnsupportedMediaType:
+		code = "UNSUPPORTED_MEDIA_TYPE"
+	}
+
+	problem := NewProblem(w, r, de.Status, code, de.Message)
+	if de.Field != "" {
+		problem.Extensions["errors"] = map[string]string{de.Field: de.Message}
+	}
+
+	Render(w, r, de.Status, problem)
+}
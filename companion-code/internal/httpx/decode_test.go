@@ -0,0 +1,111 @@
+package httpx
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestDecodeJSON tests the strict decoding rules and their error mapping.
+// PHP equivalent: testing a request DTO resolver with malformed payloads
+func TestDecodeJSON(t *testing.T) {
+	type address struct {
+		City string `json:"city"`
+	}
+	type payload struct {
+		Name    string  `json:"name"`
+		Age     int     `json:"age"`
+		Address address `json:"address"`
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantField   string
+	}{
+		{"valid", "application/json", `{"name": "Alice", "age": 30}`, 0, ""},
+		{"json with charset", "application/json; charset=utf-8", `{"name": "Alice"}`, 0, ""},
+		{"vendor json type", "application/vnd.api+json", `{"name": "Alice"}`, 0, ""},
+		{"missing content type", "", `{"name": "Alice"}`, http.StatusUnsupportedMediaType, ""},
+		{"form content type", "application/x-www-form-urlencoded", `name=Alice`, http.StatusUnsupportedMediaType, ""},
+		{"empty body", "application/json", ``, http.StatusBadRequest, ""},
+		{"syntax error", "application/json", `{"name": }`, http.StatusBadRequest, ""},
+		{"truncated", "application/json", `{"name": "Alice"`, http.StatusBadRequest, ""},
+		{"unknown field", "application/json", `{"name": "Alice", "admin": true}`, http.StatusBadRequest, "admin"},
+		{"wrong type", "application/json", `{"age": "thirty"}`, http.StatusBadRequest, "age"},
+		{"wrong nested type", "application/json", `{"address": {"city": 42}}`, http.StatusBadRequest, "address.city"},
+		{"trailing value", "application/json", `{"name": "Alice"} {"name": "Bob"}`, http.StatusBadRequest, ""},
+		{"too large", "application/json", `{"name": "` + strings.Repeat("a", MaxBodyBytes) + `"}`, http.StatusRequestEntityTooLarge, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			var dst payload
+			err := DecodeJSON(httptest.NewRecorder(), req, &dst)
+
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				return
+			}
+
+			de, ok := err.(*DecodeError)
+			if !ok {
+				t.Fatalf("Expected *DecodeError, got %T (%v)", err, err)
+			}
+			if de.Status != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d (%s)", tt.wantStatus, de.Status, de.Message)
+			}
+			if de.Field != tt.wantField {
+				t.Errorf("Expected field %q, got %q", tt.wantField, de.Field)
+			}
+		})
+	}
+}
+
+// TestWriteDecodeError tests the problem written for a rejected body.
+func TestWriteDecodeError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantField  string
+	}{
+		{"unknown field", &DecodeError{Status: http.StatusBadRequest, Field: "role", Message: "Unknown field"}, http.StatusBadRequest, "INVALID_JSON", "role"},
+		{"too large", &DecodeError{Status: http.StatusRequestEntityTooLarge, Message: "Too large"}, http.StatusRequestEntityTooLarge, "PAYLOAD_TOO_LARGE", ""},
+		{"wrong content type", &DecodeError{Status: http.StatusUnsupportedMediaType, Message: "JSON only"}, http.StatusUnsupportedMediaType, "UNSUPPORTED_MEDIA_TYPE", ""},
+		{"other error", errors.New("boom"), http.StatusBadRequest, "INVALID_JSON", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			WriteDecodeError(w, httptest.NewRequest("POST", "/users", nil), tt.err)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			var problem Problem
+			json.NewDecoder(w.Body).Decode(&problem)
+			if problem.Extensions["code"] != tt.wantCode {
+				t.Errorf("Expected code %s, got %v", tt.wantCode, problem.Extensions["code"])
+			}
+			errs, _ := problem.Extensions["errors"].(map[string]interface{})
+			if _, ok := errs[tt.wantField]; tt.wantField != "" && !ok {
+				t.Errorf("Expected an error for field %q, got %v", tt.wantField, problem.Extensions)
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+// Package httpx holds the HTTP helpers the examples share: content
+// negotiation (Render), RFC 7807 problems, strict JSON decoding, request
+// IDs, conditional requests, response compression and TLS settings.
+// Each example imports it, so they all answer and fail the same way.
+// PHP equivalent: a small internal Composer package required by every app
+package httpx
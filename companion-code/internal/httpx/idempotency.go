@@ -0,0 +1,258 @@
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Errors from IdempotencyStore.Begin.
+var (
+	ErrIdempotencyKeyInFlight = errors.New("idempotency key: first request still in progress")
+	ErrIdempotencyKeyReused   = errors.New("idempotency key: used for a different request")
+)
+
+// maxIdempotencyKeyLength bounds keys; clients normally send a UUID.
+const maxIdempotencyKeyLength = 255
+
+// StoredResponse is what a handler sent the first time, replayed for retries.
+type StoredResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyStore remembers the response to each idempotency key.
+// Begin claims key for a request whose method, path and body hash to
+// fingerprint. It returns the stored response if the key has one, or
+// claims the key and returns nil, in which case the caller must Complete
+// or Release it.
+// PHP equivalent: a cache pool of responses, locked with the Lock component
+type IdempotencyStore interface {
+	Begin(ctx context.Context, key, fingerprint string, now time.Time) (*StoredResponse, error)
+	Complete(ctx context.Context, key string, resp StoredResponse, now time.Time) error
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyMiddleware makes POST requests carrying an Idempotency-Key
+// header safe to retry (draft-ietf-httpapi-idempotency-key-header). The
+// first response for a key is stored and replayed, with an
+// Idempotent-Replayed header, for retries by the same caller. A retry
+// while the first request is running gets 409; reusing a key for a
+// different body gets 422. Server errors are not stored, so a retry gets
+// a fresh attempt. Keys are scoped to the caller, so it must run after
+// the middleware that identifies them.
+//
+// principal names the caller. It must stay the same across a client's
+// retries, so base it on a verified identity such as a token subject, not
+// on the credentials themselves, which a client may refresh in between.
+// PHP equivalent: a kernel.request/kernel.response listener pair caching responses by key
+func IdempotencyMiddleware(store IdempotencyStore, principal func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				WriteProblem(w, r, http.StatusBadRequest, "INVALID_IDEMPOTENCY_KEY", "Idempotency-Key must be at most 255 characters")
+				return
+			}
+
+			// The body is read here to fingerprint it, then handed on unchanged
+			r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					WriteDecodeError(w, r, TranslateDecodeError(err))
+					return
+				}
+				WriteProblem(w, r, http.StatusBadRequest, "BAD_REQUEST", "Could not read the request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			storeKey := principal(r) + "\x00" + key
+			stored, err := store.Begin(r.Context(), storeKey, requestFingerprint(r, body), time.Now())
+			switch {
+			case errors.Is(err, ErrIdempotencyKeyReused):
+				WriteProblem(w, r, http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED", "This Idempotency-Key was already used for a different request")
+				return
+			case errors.Is(err, ErrIdempotencyKeyInFlight):
+				w.Header().Set("Retry-After", "1")
+				WriteProblem(w, r, http.StatusConflict, "IDEMPOTENCY_KEY_IN_USE", "A request with this Idempotency-Key is still in progress")
+				return
+			case err != nil:
+				slog.ErrorContext(r.Context(), "idempotency store failed", "error", err, "request_id", RequestIDFromContext(r.Context()))
+				WriteProblem(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "An unexpected error occurred")
+				return
+			case stored != nil:
+				replayResponse(w, *stored)
+				return
+			}
+
+			// Until Complete succeeds, a panic or server error frees the key again
+			completed := false
+			defer func() {
+				if !completed {
+					if err := store.Release(context.WithoutCancel(r.Context()), storeKey); err != nil {
+						slog.ErrorContext(r.Context(), "idempotency key release failed", "error", err, "request_id", RequestIDFromContext(r.Context()))
+					}
+				}
+			}()
+
+			rec := &responseCapture{ResponseWriter: w, before: w.Header().Clone()}
+			next.ServeHTTP(rec, r)
+
+			if rec.status == 0 || rec.status >= 500 {
+				return
+			}
+			resp := StoredResponse{Status: rec.status, Header: rec.header, Body: rec.body.Bytes()}
+			if err := store.Complete(context.WithoutCancel(r.Context()), storeKey, resp, time.Now()); err != nil {
+				slog.ErrorContext(r.Context(), "idempotent response not stored", "error", err, "request_id", RequestIDFromContext(r.Context()))
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+// requestFingerprint hashes what makes two requests "the same".
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replayResponse writes a stored response again.
+func replayResponse(w http.ResponseWriter, resp StoredResponse) {
+	for name, values := range resp.Header {
+		w.Header()[name] = slices.Clone(values)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// responseCapture copies the response as it is written. Only headers the
+// handler set are kept: outer middleware adds its own, such as the request
+// ID, to the replay.
+type responseCapture struct {
+	http.ResponseWriter
+	before http.Header
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (rc *responseCapture) WriteHeader(status int) {
+	if rc.status == 0 && status >= 200 {
+		rc.status = status
+		rc.header = make(http.Header)
+		for name, values := range rc.ResponseWriter.Header() {
+			if !slices.Equal(values, rc.before[name]) {
+				rc.header[name] = slices.Clone(values)
+			}
+		}
+	}
+	rc.ResponseWriter.WriteHeader(status)
+}
+
+func (rc *responseCapture) Write(b []byte) (int, error) {
+	if rc.status == 0 {
+		rc.WriteHeader(http.StatusOK)
+	}
+	rc.body.Write(b)
+	return rc.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rc *responseCapture) Unwrap() http.ResponseWriter {
+	return rc.ResponseWriter
+}
+
+// --- In-memory store ---
+
+type idempotencyEntry struct {
+	fingerprint string
+	response    *StoredResponse // nil while the first request runs
+	expires     time.Time
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore for a single instance.
+// Keys, finished or not, are forgotten ttl after they were claimed or
+// completed.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*idempotencyEntry
+	swept   time.Time
+}
+
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{ttl: ttl, entries: make(map[string]*idempotencyEntry)}
+}
+
+func (s *MemoryIdempotencyStore) Begin(_ context.Context, key, fingerprint string, now time.Time) (*StoredResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	e, ok := s.entries[key]
+	if !ok || !now.Before(e.expires) {
+		s.entries[key] = &idempotencyEntry{fingerprint: fingerprint, expires: now.Add(s.ttl)}
+		return nil, nil
+	}
+	if e.fingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if e.response == nil {
+		return nil, ErrIdempotencyKeyInFlight
+	}
+	return e.response, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key string, resp StoredResponse, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return errors.New("idempotency key: completed without Begin")
+	}
+	e.response = &resp
+	e.expires = now.Add(s.ttl)
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep drops expired entries to bound memory. It runs at most once a minute.
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.swept) < time.Minute {
+		return
+	}
+	s.swept = now
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
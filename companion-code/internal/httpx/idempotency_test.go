@@ -0,0 +1,178 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPrincipal stands in for the caller's verified identity.
+func testPrincipal(r *http.Request) string {
+	return r.Header.Get("X-Principal")
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryIdempotencyStore(time.Hour)
+
+	if resp, err := store.Begin(ctx, "k", "fp", start); resp != nil || err != nil {
+		t.Fatalf("first Begin = %v, %v; want the key claimed", resp, err)
+	}
+	if _, err := store.Begin(ctx, "k", "fp", start); err != ErrIdempotencyKeyInFlight {
+		t.Errorf("Begin while in flight: err = %v", err)
+	}
+	if _, err := store.Begin(ctx, "k", "other", start); err != ErrIdempotencyKeyReused {
+		t.Errorf("Begin with another fingerprint: err = %v", err)
+	}
+
+	want := StoredResponse{Status: http.StatusCreated, Body: []byte(`{"id":1}`)}
+	if err := store.Complete(ctx, "k", want, start.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := store.Begin(ctx, "k", "fp", start.Add(time.Hour)); err != nil || resp == nil || resp.Status != want.Status {
+		t.Errorf("Begin after Complete = %v, %v; want the stored response", resp, err)
+	}
+
+	// The TTL runs from completion
+	if resp, err := store.Begin(ctx, "k", "other", start.Add(61*time.Minute)); resp != nil || err != nil {
+		t.Errorf("Begin after expiry = %v, %v; want the key claimed afresh", resp, err)
+	}
+
+	store.Release(ctx, "k")
+	if resp, err := store.Begin(ctx, "k", "fp", start.Add(62*time.Minute)); resp != nil || err != nil {
+		t.Errorf("Begin after Release = %v, %v; want the key claimed afresh", resp, err)
+	}
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		calls   int
+		release chan struct{} // When set, the handler waits on it
+		entered chan struct{}
+	)
+	h := IdempotencyMiddleware(NewMemoryIdempotencyStore(time.Hour), testPrincipal)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		n := calls
+		wait, started := release, entered
+		mu.Unlock()
+		if wait != nil {
+			close(started)
+			<-wait
+		}
+
+		if r.URL.Path == "/fail" {
+			WriteProblem(w, r, http.StatusServiceUnavailable, "UNAVAILABLE", "Try again")
+			return
+		}
+		w.Header().Set("Location", "/users/1")
+		Render(w, r, http.StatusCreated, map[string]int{"call": n})
+	}))
+
+	post := func(path, key, principal, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		if principal != "" {
+			req.Header.Set("X-Principal", principal)
+		}
+		rec := httptest.NewRecorder()
+		rec.Header().Set("X-Request-ID", "outer")
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := post("/users", "key-1", "", `{"name":"Alice"}`)
+	if first.Code != http.StatusCreated || first.Body.String() != `{"call":1}`+"\n" {
+		t.Fatalf("first = %d %s", first.Code, first.Body)
+	}
+
+	retry := post("/users", "key-1", "", `{"name":"Alice"}`)
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry = %d %s; want the first response", retry.Code, retry.Body)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" || retry.Header().Get("Location") != "/users/1" {
+		t.Errorf("retry headers = %v", retry.Header())
+	}
+	if got := retry.Header().Values("X-Request-ID"); len(got) != 1 {
+		t.Errorf("outer headers were replayed too: X-Request-ID = %v", got)
+	}
+
+	tests := []struct {
+		name                 string
+		path, key, who, body string
+		status               int
+		code                 string
+	}{
+		{"different body", "/users", "key-1", "", `{"name":"Bob"}`, http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED"},
+		{"different path", "/other", "key-1", "", `{"name":"Alice"}`, http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED"},
+		{"another caller", "/users", "key-1", "7", `{"name":"Alice"}`, http.StatusCreated, ""},
+		{"key too long", "/users", strings.Repeat("k", 256), "", `{}`, http.StatusBadRequest, "INVALID_IDEMPOTENCY_KEY"},
+	}
+	for _, tt := range tests {
+		rec := post(tt.path, tt.key, tt.who, tt.body)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, rec.Code, tt.status, rec.Body)
+			continue
+		}
+		if tt.code != "" {
+			var p Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Extensions["code"] != tt.code {
+				t.Errorf("%s: code = %v, want %s", tt.name, p.Extensions["code"], tt.code)
+			}
+		}
+	}
+
+	// Server errors are not stored
+	before := calls
+	post("/fail", "key-2", "", `{}`)
+	post("/fail", "key-2", "", `{}`)
+	if calls-before != 2 {
+		t.Errorf("a failed request was replayed instead of retried")
+	}
+
+	// Without a key every request runs
+	before = calls
+	post("/users", "", "", `{}`)
+	post("/users", "", "", `{}`)
+	if calls-before != 2 {
+		t.Errorf("requests without a key ran %d times, want 2", calls-before)
+	}
+
+	// A retry while the first request runs is told to wait
+	mu.Lock()
+	release, entered = make(chan struct{}), make(chan struct{})
+	wait, started := release, entered
+	mu.Unlock()
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- post("/users", "key-3", "", `{}`) }()
+	<-started
+	mu.Lock()
+	release = nil
+	mu.Unlock()
+
+	inFlight := post("/users", "key-3", "", `{}`)
+	if inFlight.Code != http.StatusConflict || inFlight.Header().Get("Retry-After") == "" {
+		t.Errorf("concurrent retry = %d, Retry-After %q; want 409 with Retry-After", inFlight.Code, inFlight.Header().Get("Retry-After"))
+	}
+	close(wait)
+	if rec := <-done; rec.Code != http.StatusCreated {
+		t.Errorf("first request = %d", rec.Code)
+	}
+	if rec := post("/users", "key-3", "", `{}`); rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry after completion was not replayed")
+	}
+}
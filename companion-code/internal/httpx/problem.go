@@ -0,0 +1,136 @@
+package httpx
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// Problem is an RFC 7807 problem details object, the body of every error
+// response. Extensions are extra members, flattened into the object beside
+// the standard ones; every problem has a machine-readable "code" and, in a
+// request, the "request_id".
+// PHP equivalent: Symfony's ProblemNormalizer output for a FlattenException
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]interface{}
+}
+
+// NewProblem builds the problem for a failed request. The type is
+// "about:blank", so the title is the standard status text (RFC 7807 §4.2),
+// and code, such as "NOT_FOUND", tells clients what failed. The detail is
+// shown to users, so it must not echo request input back. The request ID
+// is included so users can quote it when reporting errors.
+func NewProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) Problem {
+	p := Problem{
+		Type:       "about:blank",
+		Title:      http.StatusText(status),
+		Status:     status,
+		Detail:     detail,
+		Instance:   r.URL.Path,
+		Extensions: map[string]interface{}{"code": code},
+	}
+
+	// Stored by the request ID middleware; the headers cover handlers run without it
+	id := RequestIDFromContext(r.Context())
+	if id == "" {
+		id = w.Header().Get("X-Request-ID")
+	}
+	if id == "" {
+		id = r.Header.Get("X-Request-ID")
+	}
+	if id != "" {
+		p.Extensions["request_id"] = id
+	}
+	return p
+}
+
+// WriteProblem renders a problem with the given status, code and detail.
+// PHP equivalent: throw new HttpException($status, $detail)
+func WriteProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	Render(w, r, status, NewProblem(w, r, status, code, detail))
+}
+
+// problemMembers are the standard members; extensions may not override them.
+var problemMembers = map[string]bool{"type": true, "title": true, "status": true, "detail": true, "instance": true}
+
+// MarshalJSON writes the standard members first, then the extensions in
+// key order, so output is stable.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	write := func(key string, v interface{}) error {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		val, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(val)
+		return nil
+	}
+
+	write("type", p.Type)
+	write("title", p.Title)
+	write("status", p.Status)
+	if p.Detail != "" {
+		write("detail", p.Detail)
+	}
+	if p.Instance != "" {
+		write("instance", p.Instance)
+	}
+
+	keys := make([]string, 0, len(p.Extensions))
+	for k := range p.Extensions {
+		if !problemMembers[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := write(k, p.Extensions[k]); err != nil {
+			return nil, err
+		}
+	}
+
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON reads the standard members and collects the rest as extensions.
+func (p *Problem) UnmarshalJSON(b []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	*p = Problem{Extensions: make(map[string]interface{})}
+	targets := map[string]interface{}{
+		"type": &p.Type, "title": &p.Title, "status": &p.Status,
+		"detail": &p.Detail, "instance": &p.Instance,
+	}
+	for k, v := range raw {
+		if target, ok := targets[k]; ok {
+			if err := json.Unmarshal(v, target); err != nil {
+				return err
+			}
+			continue
+		}
+		var ext interface{}
+		if err := json.Unmarshal(v, &ext); err != nil {
+			return err
+		}
+		p.Extensions[k] = ext
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package httpx
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestProblemJSON tests member order, extensions and the round trip.
+func TestProblemJSON(t *testing.T) {
+	p := Problem{
+		Type:       "about:blank",
+		Title:      "Not Found",
+		Status:     404,
+		Detail:     "User not found",
+		Instance:   "/users/9",
+		Extensions: map[string]interface{}{"request_id": "abc", "code": "NOT_FOUND", "status": 200},
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"about:blank","title":"Not Found","status":404,"detail":"User not found","instance":"/users/9","code":"NOT_FOUND","request_id":"abc"}`
+	if string(b) != want {
+		t.Errorf("Expected %s, got %s", want, b)
+	}
+
+	var back Problem
+	if err := json.Unmarshal(b, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back.Status != 404 || back.Detail != "User not found" || back.Extensions["request_id"] != "abc" {
+		t.Errorf("Round trip lost data: %+v", back)
+	}
+}
+
+// TestNewProblemRequestID tests where the request ID is taken from:
+// the context first, then the response and request headers.
+func TestNewProblemRequestID(t *testing.T) {
+	tests := []struct {
+		name                      string
+		fromContext, fromResponse string
+		fromRequest, want         string
+	}{
+		{"context", "ctx-id", "resp-id", "req-id", "ctx-id"},
+		{"response header", "", "resp-id", "req-id", "resp-id"},
+		{"request header", "", "", "req-id", "req-id"},
+		{"none", "", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/users/99", nil)
+			if tt.fromContext != "" {
+				req = req.WithContext(WithRequestID(req.Context(), tt.fromContext))
+			}
+			if tt.fromRequest != "" {
+				req.Header.Set("X-Request-ID", tt.fromRequest)
+			}
+			w := httptest.NewRecorder()
+			if tt.fromResponse != "" {
+				w.Header().Set("X-Request-ID", tt.fromResponse)
+			}
+
+			p := NewProblem(w, req, http.StatusNotFound, "NOT_FOUND", "User not found")
+			if p.Title != "Not Found" || p.Instance != "/users/99" || p.Extensions["code"] != "NOT_FOUND" {
+				t.Errorf("Unexpected problem %+v", p)
+			}
+			if id, _ := p.Extensions["request_id"].(string); id != tt.want {
+				t.Errorf("Expected request_id %q, got %q", tt.want, id)
+			}
+		})
+	}
+}
@@ -0,0 +1,572 @@
+package httpx
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// encoder turns a normalised value into a response body.
+type encoder func(v interface{}, pretty bool) ([]byte, error)
+
+// format is a media type the renderer can produce.
+type format struct {
+	mediaType   string
+	contentType string
+	aliases     []string
+	problemType string // Content-Type for Problem bodies, if the format has one
+	listsOnly   bool
+	encode      encoder
+}
+
+// formats is ordered by server preference, used to break q-value ties.
+// PHP equivalent: the 'formats' option of FOSRestBundle's format_listener
+var formats = []format{
+	{mediaType: "application/json", contentType: "application/json", aliases: []string{"application/problem+json"}, problemType: "application/problem+json", encode: encodeJSON},
+	{mediaType: "application/xml", contentType: "application/xml; charset=utf-8", aliases: []string{"text/xml", "application/problem+xml"}, problemType: "application/problem+xml; charset=utf-8", encode: encodeXML},
+	{mediaType: "text/csv", contentType: "text/csv; charset=utf-8", listsOnly: true, encode: encodeCSV},
+	{mediaType: "application/msgpack", contentType: "application/msgpack", aliases: []string{"application/x-msgpack", "application/vnd.msgpack"}, encode: encodeMsgpack},
+}
+
+// addVary adds field to the Vary header unless a value already lists it,
+// or "*", so that rendering or wrapping a response twice does not repeat it.
+func addVary(h http.Header, field string) {
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			f = strings.TrimSpace(f)
+			if f == "*" || strings.EqualFold(f, field) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", field)
+}
+
+// Render writes data in the format selected by the request's Accept header.
+// JSON is used when the client accepts anything; 406 is returned when it
+// accepts nothing we offer. Add ?pretty=true for indented output.
+// PHP equivalent: $this->json() combined with Symfony Serializer's format negotiation
+func Render(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+	addVary(w.Header(), "Accept")
+
+	f, ok := negotiate(r.Header.Get("Accept"), isList(data))
+	if e, isEnvelope := data.(ListEnvelope); ok && isEnvelope && f.listsOnly {
+		data = e.Items() // CSV has no room for the envelope, only the rows
+	}
+	if !ok {
+		// Fall back to JSON so the client can at least read the error
+		f = formats[0]
+		status = http.StatusNotAcceptable
+		data = NewProblem(w, r, status, "NOT_ACCEPTABLE", "Supported types: "+strings.Join(offered(isList(data)), ", "))
+	}
+
+	pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty"))
+
+	body, err := f.encode(data, pretty)
+	if err != nil {
+		// Encode into a buffer first so a failure can still become a clean 500
+		// PHP equivalent: Serializer throwing NotEncodableValueException
+		slog.ErrorContext(r.Context(), "response encoding failed", "content_type", f.mediaType, "error", err, "request_id", RequestIDFromContext(r.Context()))
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusInternalServerError)
+		body := `{"type":"about:blank","title":"Internal Server Error","status":500`
+		if id := RequestIDFromContext(r.Context()); id != "" {
+			quoted, _ := json.Marshal(id)
+			body += `,"request_id":` + string(quoted)
+		}
+		w.Write([]byte(body + "}\n"))
+		return
+	}
+
+	contentType := f.contentType
+	if _, isProblem := data.(Problem); isProblem && f.problemType != "" {
+		contentType = f.problemType
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		slog.WarnContext(r.Context(), "response write failed", "error", err, "request_id", RequestIDFromContext(r.Context()))
+	}
+}
+
+// negotiate picks the best format for an Accept header.
+// Each format takes the q-value of the most specific range that matches it,
+// so "application/json;q=0, */*" rules JSON out.
+func negotiate(accept string, list bool) (format, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return formats[0], true
+	}
+
+	ranges := ParseAccept(accept)
+	best, bestQ := -1, 0.0
+	for i, f := range formats {
+		if f.listsOnly && !list {
+			continue
+		}
+
+		q, specificity := 0.0, -1
+		for _, ar := range ranges {
+			if s := f.specificity(ar.Value); s > specificity {
+				q, specificity = ar.Q, s
+			}
+		}
+
+		// Formats are in preference order, so only a strictly higher q wins
+		if q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+
+	if best < 0 {
+		return format{}, false
+	}
+	return formats[best], true
+}
+
+// specificity rates how closely a media range matches this format:
+// 2 for an exact type, 1 for "type/*", 0 for "*/*" and -1 for no match.
+func (f format) specificity(mediaRange string) int {
+	if mediaRange == "*/*" {
+		return 0
+	}
+	score := -1
+	for _, mt := range append([]string{f.mediaType}, f.aliases...) {
+		if mediaRange == mt {
+			return 2
+		}
+		if strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mt, strings.TrimSuffix(mediaRange, "*")) {
+			score = 1
+		}
+	}
+	return score
+}
+
+// offered lists the media types available for a response.
+func offered(list bool) []string {
+	var types []string
+	for _, f := range formats {
+		if !f.listsOnly || list {
+			types = append(types, f.mediaType)
+		}
+	}
+	return types
+}
+
+// AcceptRange is one entry of an Accept or Accept-Language header.
+type AcceptRange struct {
+	Value string // Lower-cased, e.g. "application/json" or "fr-ca"
+	Q     float64
+}
+
+// ParseAccept splits an Accept-style header into ranges with their q-values.
+func ParseAccept(header string) []AcceptRange {
+	var ranges []AcceptRange
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		ar := AcceptRange{Value: strings.ToLower(strings.TrimSpace(params[0])), Q: 1}
+		for _, p := range params[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.ToLower(k) == "q" {
+				if q, err := strconv.ParseFloat(v, 64); err == nil {
+					ar.Q = q
+				}
+			}
+		}
+		if ar.Value != "" {
+			ranges = append(ranges, ar)
+		}
+	}
+	return ranges
+}
+
+// ListEnvelope is implemented by list responses wrapped in metadata,
+// such as {"data": [...], "count": 2}, so they can still be served as CSV.
+type ListEnvelope interface {
+	Items() interface{}
+}
+
+// isList reports whether data is a slice or array, the only shape CSV can represent.
+func isList(data interface{}) bool {
+	if e, ok := data.(ListEnvelope); ok {
+		data = e.Items()
+	}
+	if data == nil {
+		return false
+	}
+	k := reflect.TypeOf(data).Kind()
+	return k == reflect.Slice || k == reflect.Array
+}
+
+// --- Normalisation ---
+//
+// Every non-JSON format goes through JSON first, so struct tags like
+// `json:"created_at"` and `json:"-"` apply to all formats alike.
+// PHP equivalent: Serializer normalising objects to arrays before encoding
+
+// field is one key/value pair of a JSON object, kept in document order.
+type field struct {
+	key   string
+	value interface{}
+}
+
+// object is a JSON object that preserves key order (unlike map[string]interface{}).
+type object []field
+
+// normalise converts data into nil, bool, string, json.Number, []interface{} and object values.
+func normalise(data interface{}) (interface{}, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	return decodeValue(dec)
+}
+
+func decodeValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		obj := object{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, field{key: key.(string), value: v})
+		}
+		_, err := dec.Token() // Closing '}'
+		return obj, err
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			v, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		_, err := dec.Token() // Closing ']'
+		return arr, err
+	}
+
+	return tok, nil
+}
+
+// --- Encoders ---
+
+func encodeJSON(data interface{}, pretty bool) ([]byte, error) {
+	if pretty {
+		b, err := json.MarshalIndent(data, "", "  ")
+		return append(b, '\n'), err
+	}
+	b, err := json.Marshal(data)
+	return append(b, '\n'), err
+}
+
+// encodeXML writes objects as elements named after their keys and list items as <item>.
+func encodeXML(data interface{}, pretty bool) ([]byte, error) {
+	v, err := normalise(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	if pretty {
+		enc.Indent("", "  ")
+	}
+	if err := writeXMLElement(enc, "response", v); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func writeXMLElement(enc *xml.Encoder, name string, v interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !isXMLName(name) {
+		// JSON keys may not be valid XML names: <entry key="...">
+		start = xml.StartElement{
+			Name: xml.Name{Local: "entry"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}},
+		}
+	}
+
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case object:
+		for _, f := range v {
+			if err := writeXMLElement(enc, f.key, f.value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := writeXMLElement(enc, "item", item); err != nil {
+				return err
+			}
+		}
+	case nil:
+		// Empty element
+	default:
+		if err := enc.EncodeToken(xml.CharData(scalarString(v))); err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// isXMLName reports whether s is a safe XML element name (ASCII subset).
+func isXMLName(s string) bool {
+	if s == "" || strings.HasPrefix(strings.ToLower(s), "xml") {
+		return false
+	}
+	for i, c := range s {
+		letter := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !letter && (i == 0 || !(c == '-' || c == '.' || (c >= '0' && c <= '9'))) {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeCSV writes one row per list item with a header row built from the item keys.
+// Nested values are written as JSON.
+func encodeCSV(data interface{}, _ bool) ([]byte, error) {
+	v, err := normalise(data)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("csv: data is not a list")
+	}
+
+	// Columns in order of first appearance across all rows
+	var columns []string
+	index := make(map[string]int)
+	for _, item := range items {
+		obj, ok := item.(object)
+		if !ok {
+			return nil, fmt.Errorf("csv: list item is %T, not an object", item)
+		}
+		for _, f := range obj {
+			if _, seen := index[f.key]; !seen {
+				index[f.key] = len(columns)
+				columns = append(columns, f.key)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	if err := cw.Write(columns); err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		row := make([]string, len(columns))
+		for _, f := range item.(object) {
+			switch f.value.(type) {
+			case object, []interface{}:
+				nested, err := json.Marshal(toInterface(f.value))
+				if err != nil {
+					return nil, err
+				}
+				row[index[f.key]] = string(nested)
+			default:
+				row[index[f.key]] = scalarString(f.value)
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	cw.Flush()
+	return buf.Bytes(), cw.Error()
+}
+
+// toInterface converts ordered objects back into maps so encoding/json can re-encode them.
+func toInterface(v interface{}) interface{} {
+	switch v := v.(type) {
+	case object:
+		m := make(map[string]interface{}, len(v))
+		for _, f := range v {
+			m[f.key] = toInterface(f.value)
+		}
+		return m
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = toInterface(item)
+		}
+		return out
+	}
+	return v
+}
+
+func scalarString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// encodeMsgpack writes the MessagePack binary encoding (https://msgpack.org/).
+// PHP equivalent: msgpack_pack() from the msgpack PECL extension
+func encodeMsgpack(data interface{}, _ bool) ([]byte, error) {
+	v, err := normalise(data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := writeMsgpack(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeMsgpack(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			writeMsgpackInt(buf, i)
+		} else if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			buf.WriteByte(0xcf)
+			writeUint(buf, u, 8)
+		} else if f, err := v.Float64(); err == nil {
+			buf.WriteByte(0xcb)
+			writeUint(buf, math.Float64bits(f), 8)
+		} else {
+			return fmt.Errorf("msgpack: invalid number %q", v)
+		}
+	case string:
+		writeMsgpackHeader(buf, len(v), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		buf.WriteString(v)
+	case []interface{}:
+		writeMsgpackHeader(buf, len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, item := range v {
+			if err := writeMsgpack(buf, item); err != nil {
+				return err
+			}
+		}
+	case object:
+		writeMsgpackHeader(buf, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		for _, f := range v {
+			if err := writeMsgpack(buf, f.key); err != nil {
+				return err
+			}
+			if err := writeMsgpack(buf, f.value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %T", v)
+	}
+	return nil
+}
+
+// writeMsgpackHeader writes a length-prefixed type marker: the fix form when
+// n < fixMax, otherwise the 8-bit (if available), 16-bit or 32-bit form.
+func writeMsgpackHeader(buf *bytes.Buffer, n int, fix byte, fixMax int, m8, m16, m32 byte) {
+	switch {
+	case n < fixMax:
+		buf.WriteByte(fix | byte(n))
+	case m8 != 0 && n <= math.MaxUint8:
+		buf.WriteByte(m8)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(m16)
+		writeUint(buf, uint64(n), 2)
+	default:
+		buf.WriteByte(m32)
+		writeUint(buf, uint64(n), 4)
+	}
+}
+
+func writeMsgpackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i < 128:
+		buf.WriteByte(byte(i)) // Positive fixint
+	case i >= 0:
+		u := uint64(i)
+		switch {
+		case u <= math.MaxUint8:
+			buf.WriteByte(0xcc)
+			writeUint(buf, u, 1)
+		case u <= math.MaxUint16:
+			buf.WriteByte(0xcd)
+			writeUint(buf, u, 2)
+		case u <= math.MaxUint32:
+			buf.WriteByte(0xce)
+			writeUint(buf, u, 4)
+		default:
+			buf.WriteByte(0xcf)
+			writeUint(buf, u, 8)
+		}
+	case i >= -32:
+		buf.WriteByte(byte(i)) // Negative fixint
+	case i >= math.MinInt8:
+		buf.WriteByte(0xd0)
+		writeUint(buf, uint64(i), 1)
+	case i >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		writeUint(buf, uint64(i), 2)
+	case i >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		writeUint(buf, uint64(i), 4)
+	default:
+		buf.WriteByte(0xd3)
+		writeUint(buf, uint64(i), 8)
+	}
+}
+
+// writeUint writes the low n bytes of u in big-endian order.
+func writeUint(buf *bytes.Buffer, u uint64, n int) {
+	for shift := (n - 1) * 8; shift >= 0; shift -= 8 {
+		buf.WriteByte(byte(u >> shift))
+	}
+}
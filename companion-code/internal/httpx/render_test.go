@@ -0,0 +1,188 @@
+package httpx
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// contact is a fixed shape for format tests, independent of User.
+type contact struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// TestRenderNegotiation tests format selection from the Accept header.
+// PHP equivalent: testing FOSRestBundle's format_listener rules
+func TestRenderNegotiation(t *testing.T) {
+	list := []contact{{ID: 1, Name: "Alice", Email: "alice@example.com"}}
+	single := contact{ID: 1, Name: "Alice", Email: "alice@example.com"}
+
+	tests := []struct {
+		name            string
+		accept          string
+		data            interface{}
+		wantStatus      int
+		wantContentType string
+	}{
+		{"no accept header", "", single, http.StatusOK, "application/json"},
+		{"any type", "*/*", single, http.StatusOK, "application/json"},
+		{"xml", "application/xml", single, http.StatusOK, "application/xml; charset=utf-8"},
+		{"text xml alias", "text/xml", single, http.StatusOK, "application/xml; charset=utf-8"},
+		{"csv for list", "text/csv", list, http.StatusOK, "text/csv; charset=utf-8"},
+		{"csv for single resource", "text/csv", single, http.StatusNotAcceptable, "application/problem+json"},
+		{"msgpack", "application/msgpack", single, http.StatusOK, "application/msgpack"},
+		{"q-values", "application/json;q=0.5, application/xml", single, http.StatusOK, "application/xml; charset=utf-8"},
+		{"q=0 excludes", "application/json;q=0, */*;q=0.1", single, http.StatusOK, "application/xml; charset=utf-8"},
+		{"unsupported", "image/png", single, http.StatusNotAcceptable, "application/problem+json"},
+		{"problem json alias", "application/problem+json", single, http.StatusOK, "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			Render(w, req, http.StatusOK, tt.data)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.wantContentType, got)
+			}
+			if w.Header().Get("Vary") != "Accept" {
+				t.Error("Expected Vary: Accept")
+			}
+		})
+	}
+}
+
+// TestRenderVary tests that Vary lists Accept once, however many times the
+// response is rendered, and keeps the fields already there.
+func TestRenderVary(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		want     []string
+	}{
+		{"empty", nil, []string{"Accept"}},
+		{"other field", []string{"Accept-Encoding"}, []string{"Accept-Encoding", "Accept"}},
+		{"already listed", []string{"Origin, accept"}, []string{"Origin, accept"}},
+		{"star", []string{"*"}, []string{"*"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			for _, v := range tt.existing {
+				w.Header().Add("Vary", v)
+			}
+			r := httptest.NewRequest("GET", "/", nil)
+			Render(w, r, http.StatusOK, contact{ID: 1})
+			Render(w, r, http.StatusOK, contact{ID: 1})
+
+			if got := w.Header().Values("Vary"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Vary = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRenderXML tests the XML shape of a list response.
+func TestRenderXML(t *testing.T) {
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Accept", "application/xml")
+	w := httptest.NewRecorder()
+
+	Render(w, req, http.StatusOK, []contact{{ID: 1, Name: "Alice & Co", Email: "alice@example.com"}})
+
+	want := `<response><item><id>1</id><name>Alice &amp; Co</name><email>alice@example.com</email></item></response>`
+	if !strings.Contains(w.Body.String(), want) {
+		t.Errorf("Expected body to contain %s, got %s", want, w.Body.String())
+	}
+}
+
+// TestRenderCSV tests the CSV header and rows.
+func TestRenderCSV(t *testing.T) {
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Accept", "text/csv")
+	w := httptest.NewRecorder()
+
+	Render(w, req, http.StatusOK, []contact{
+		{ID: 1, Name: "Alice", Email: "alice@example.com"},
+		{ID: 2, Name: "Smith, Bob", Email: "bob@example.com"},
+	})
+
+	want := "id,name,email\n1,Alice,alice@example.com\n2,\"Smith, Bob\",bob@example.com\n"
+	if w.Body.String() != want {
+		t.Errorf("Expected %q, got %q", want, w.Body.String())
+	}
+}
+
+// TestRenderMsgpack tests the MessagePack bytes for a small object.
+func TestRenderMsgpack(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "application/msgpack")
+	w := httptest.NewRecorder()
+
+	Render(w, req, http.StatusOK, struct {
+		ID     int    `json:"id"`
+		Name   string `json:"name"`
+		Admin  bool   `json:"admin"`
+		Score  int    `json:"score"`
+		Parent *int   `json:"parent"`
+	}{ID: 1, Name: "Al", Admin: true, Score: -300})
+
+	want := []byte{
+		0x85,                 // fixmap, 5 entries
+		0xa2, 'i', 'd', 0x01, // "id": 1
+		0xa4, 'n', 'a', 'm', 'e', 0xa2, 'A', 'l', // "name": "Al"
+		0xa5, 'a', 'd', 'm', 'i', 'n', 0xc3, // "admin": true
+		0xa5, 's', 'c', 'o', 'r', 'e', 0xd1, 0xfe, 0xd4, // "score": int16(-300)
+		0xa6, 'p', 'a', 'r', 'e', 'n', 't', 0xc0, // "parent": nil
+	}
+	if !bytes.Equal(w.Body.Bytes(), want) {
+		t.Errorf("Expected % x, got % x", want, w.Body.Bytes())
+	}
+}
+
+// TestRenderPretty tests indentation via the pretty query parameter.
+func TestRenderPretty(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?pretty=true", nil)
+	w := httptest.NewRecorder()
+
+	Render(w, req, http.StatusOK, map[string]string{"status": "healthy"})
+
+	if want := "{\n  \"status\": \"healthy\"\n}\n"; w.Body.String() != want {
+		t.Errorf("Expected %q, got %q", want, w.Body.String())
+	}
+}
+
+// TestRenderEncodingFailure tests that an unencodable value becomes a 500.
+func TestRenderEncodingFailure(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	Render(w, req, http.StatusOK, map[string]interface{}{"broken": make(chan int)})
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+
+	var p Problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatalf("Expected a problem body: %v", err)
+	}
+	if p.Status != http.StatusInternalServerError {
+		t.Errorf("Expected problem status 500, got %d", p.Status)
+	}
+}
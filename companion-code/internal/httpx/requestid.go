@@ -0,0 +1,57 @@
+package httpx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// MaxRequestIDLength bounds inbound IDs; a UUID is 36 characters.
+const MaxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the ID stored for the request, or "" outside
+// a request.
+// PHP equivalent: $request->attributes->get('request_id')
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ValidRequestID accepts the characters UUIDs, ULIDs and common proxy IDs
+// use. Anything else, such as a newline forging a log line, should be
+// replaced with NewRequestID.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NewRequestID returns a UUIDv7 (RFC 9562): a millisecond timestamp then
+// 74 random bits, so IDs sort by time yet never collide in practice.
+// PHP equivalent: Symfony\Component\Uid\UuidV7::generate()
+func NewRequestID() string {
+	var u [16]byte
+	binary.BigEndian.PutUint64(u[:8], uint64(time.Now().UnixMilli())<<16)
+	rand.Read(u[6:])
+	u[6] = u[6]&0x0f | 0x70 // Version 7
+	u[8] = u[8]&0x3f | 0x80 // RFC 9562 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
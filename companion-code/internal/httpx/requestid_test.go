@@ -0,0 +1,62 @@
+package httpx
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var uuidV7 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewRequestID(t *testing.T) {
+	before := time.Now().UnixMilli()
+	seen := make(map[string]bool)
+	prev := ""
+	for i := 0; i < 10000; i++ {
+		id := NewRequestID()
+		if !uuidV7.MatchString(id) {
+			t.Fatalf("%q is not a UUIDv7", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate ID %q after %d", id, i)
+		}
+		seen[id] = true
+		// The timestamp prefix makes IDs sort by creation time
+		if id[:13] < prev {
+			t.Fatalf("%q sorts before the earlier %q", id, prev)
+		}
+		prev = id[:13]
+	}
+
+	// The first 48 bits are the Unix time in milliseconds
+	id := NewRequestID()
+	var ms int64
+	for _, c := range strings.Replace(id[:13], "-", "", 1) {
+		ms = ms<<4 | int64(strings.IndexRune("0123456789abcdef", c))
+	}
+	if ms < before || ms > time.Now().UnixMilli() {
+		t.Errorf("timestamp %d outside the test run", ms)
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"0190a0b2-6c4e-7d2a-9f3e-1a2b3c4d5e6f", true},
+		{"Root=1-67891233-abcdef012345678912345678", false}, // "=" is not allowed
+		{"req_01HZX3.edge:7", true},
+		{"", false},
+		{"abc\nINFO forged line", false},
+		{"<script>", false},
+		{strings.Repeat("a", MaxRequestIDLength), true},
+		{strings.Repeat("a", MaxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		if got := ValidRequestID(tt.id); got != tt.want {
+			t.Errorf("ValidRequestID(%q) = %t, want %t", tt.id, got, tt.want)
+		}
+	}
+}
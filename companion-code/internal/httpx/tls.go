@@ -0,0 +1,170 @@
+package httpx
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSSettings configures HTTPS. TLS is off unless both cert and key are set.
+// PHP equivalent: the ssl_certificate lines in the nginx vhost in front of PHP-FPM -
+// a Go binary terminates TLS itself.
+type TLSSettings struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile enables mutual TLS: clients must present a certificate signed by this CA.
+	ClientCAFile string
+	// ReloadInterval is how often the certificate files are checked for changes.
+	ReloadInterval time.Duration
+}
+
+// LoadTLSSettings reads TLS_CERT_FILE, TLS_KEY_FILE, TLS_CLIENT_CA_FILE
+// and TLS_RELOAD_INTERVAL (default 30s) from the environment. An interval
+// that is not a positive duration is an error rather than a silent default.
+func LoadTLSSettings() (TLSSettings, error) {
+	interval := 30 * time.Second
+	if v := os.Getenv("TLS_RELOAD_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return TLSSettings{}, fmt.Errorf("TLS_RELOAD_INTERVAL must be a positive duration such as 30s, got %q", v)
+		}
+		interval = d
+	}
+
+	return TLSSettings{
+		CertFile:       os.Getenv("TLS_CERT_FILE"),
+		KeyFile:        os.Getenv("TLS_KEY_FILE"),
+		ClientCAFile:   os.Getenv("TLS_CLIENT_CA_FILE"),
+		ReloadInterval: interval,
+	}, nil
+}
+
+// Enabled reports whether HTTPS should be served.
+func (s TLSSettings) Enabled() bool {
+	return s.CertFile != "" && s.KeyFile != ""
+}
+
+// ServerConfig builds a tls.Config that serves the current certificate and
+// reloads it when the files change, until ctx is cancelled. The watcher
+// starts only once the certificate and any client CA have loaded, so a
+// failed setup leaves nothing running.
+// HTTP/2 is negotiated via ALPN, falling back to HTTP/1.1.
+func (s TLSSettings) ServerConfig(ctx context.Context) (*tls.Config, error) {
+	if s.ReloadInterval <= 0 {
+		return nil, fmt.Errorf("TLS reload interval must be positive, got %v", s.ReloadInterval)
+	}
+	reloader, err := newCertReloader(s.CertFile, s.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+
+	if s.ClientCAFile != "" {
+		pem, err := os.ReadFile(s.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("client CA file contains no certificates")
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	go reloader.watch(ctx, s.ReloadInterval)
+	return cfg, nil
+}
+
+// certReloader serves a certificate that can be swapped while the server runs,
+// so renewed certificates (e.g. from cert-manager or certbot) need no restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	certTime time.Time
+	keyTime  time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := cr.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// GetCertificate is called by crypto/tls for every handshake.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+// reloadIfChanged loads the key pair if either file's modification time moved.
+// A broken pair (e.g. cert written but key not yet) is reported and the
+// previous certificate stays in use.
+func (cr *certReloader) reloadIfChanged() (bool, error) {
+	certInfo, err := os.Stat(cr.certFile)
+	if err != nil {
+		return false, fmt.Errorf("stat certificate: %w", err)
+	}
+	keyInfo, err := os.Stat(cr.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("stat key: %w", err)
+	}
+
+	cr.mu.RLock()
+	unchanged := cr.cert != nil && certInfo.ModTime().Equal(cr.certTime) && keyInfo.ModTime().Equal(cr.keyTime)
+	cr.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("load key pair: %w", err)
+	}
+
+	cr.mu.Lock()
+	cr.cert = &cert
+	cr.certTime = certInfo.ModTime()
+	cr.keyTime = keyInfo.ModTime()
+	cr.mu.Unlock()
+	return true, nil
+}
+
+// watch polls the files every interval until ctx is cancelled.
+// Polling needs no extra dependency and works on every filesystem,
+// including Kubernetes secret volumes that swap symlinks.
+func (cr *certReloader) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := cr.reloadIfChanged()
+			if err != nil {
+				log.Printf("TLS certificate reload failed: %v", err)
+			} else if reloaded {
+				log.Printf("TLS certificate reloaded from %s", cr.certFile)
+			}
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package httpx
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA is a throwaway certificate authority for TLS tests.
+// PHP equivalent: none - PHPUnit rarely touches TLS because nginx owns it
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Generate CA key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Create CA certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue signs a leaf certificate and returns it with its key, PEM-encoded.
+func (ca *testCA) issue(t *testing.T, serial int64, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Marshal key: %v", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeKeyPair writes a server key pair into dir, returning the file paths.
+func (ca *testCA) writeKeyPair(t *testing.T, dir string, serial int64) (certFile, keyFile string) {
+	t.Helper()
+
+	certPEM, keyPEM := ca.issue(t, serial, x509.ExtKeyUsageServerAuth)
+	certFile = filepath.Join(dir, "tls.crt")
+	keyFile = filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// startTLSServer serves a handler reporting the negotiated protocol.
+func startTLSServer(t *testing.T, settings TLSSettings) string {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	cfg, err := settings.ServerConfig(ctx)
+	if err != nil {
+		t.Fatalf("ServerConfig: %v", err)
+	}
+
+	srv := &http.Server{
+		TLSConfig: cfg,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto))
+		}),
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go srv.ServeTLS(ln, "", "")
+	t.Cleanup(func() { srv.Close() })
+
+	return "https://" + ln.Addr().String()
+}
+
+// tlsClient trusts the test CA and negotiates HTTP/2 when offered.
+func tlsClient(ca *testCA, clientCert *tls.Certificate) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca.pem)
+
+	cfg := &tls.Config{RootCAs: pool}
+	if clientCert != nil {
+		cfg.Certificates = []tls.Certificate{*clientCert}
+	}
+
+	return &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig:   cfg,
+			ForceAttemptHTTP2: true,
+		},
+	}
+}
+
+// TestTLSServesHTTP2 tests HTTPS with HTTP/2 negotiated via ALPN.
+func TestTLSServesHTTP2(t *testing.T) {
+	ca := newTestCA(t)
+	certFile, keyFile := ca.writeKeyPair(t, t.TempDir(), 2)
+
+	url := startTLSServer(t, TLSSettings{CertFile: certFile, KeyFile: keyFile, ReloadInterval: time.Hour})
+
+	resp, err := tlsClient(ca, nil).Get(url)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.ProtoMajor != 2 {
+		t.Errorf("Expected HTTP/2, got %s", resp.Proto)
+	}
+}
+
+// TestCertReloader tests that a replaced certificate is picked up without a restart.
+func TestCertReloader(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := ca.writeKeyPair(t, dir, 2)
+
+	cr, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+
+	if reloaded, _ := cr.reloadIfChanged(); reloaded {
+		t.Error("Expected no reload when files are unchanged")
+	}
+
+	// Renew: new serial, and push the mtime forward in case the
+	// filesystem's timestamp resolution is coarse
+	ca.writeKeyPair(t, dir, 3)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	os.Chtimes(keyFile, future, future)
+
+	reloaded, err := cr.reloadIfChanged()
+	if err != nil || !reloaded {
+		t.Fatalf("Expected reload, got reloaded=%t err=%v", reloaded, err)
+	}
+
+	cert, _ := cr.GetCertificate(nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Parse certificate: %v", err)
+	}
+	if leaf.SerialNumber.Int64() != 3 {
+		t.Errorf("Expected renewed certificate with serial 3, got %d", leaf.SerialNumber.Int64())
+	}
+
+	// A half-written pair must not replace the working certificate
+	os.WriteFile(keyFile, []byte("garbage"), 0o600)
+	later := future.Add(time.Minute)
+	os.Chtimes(keyFile, later, later)
+
+	if _, err := cr.reloadIfChanged(); err == nil {
+		t.Error("Expected an error for a broken key file")
+	}
+	if got, _ := cr.GetCertificate(nil); got != cert {
+		t.Error("Expected the previous certificate to stay in use")
+	}
+}
+
+// TestMutualTLS tests that client certificates are required when a client CA is set.
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := ca.writeKeyPair(t, dir, 2)
+
+	caFile := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(caFile, ca.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	url := startTLSServer(t, TLSSettings{
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		ClientCAFile:   caFile,
+		ReloadInterval: time.Hour,
+	})
+
+	if resp, err := tlsClient(ca, nil).Get(url); err == nil {
+		resp.Body.Close()
+		t.Error("Expected handshake to fail without a client certificate")
+	}
+
+	clientCertPEM, clientKeyPEM := ca.issue(t, 10, x509.ExtKeyUsageClientAuth)
+	clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+	if err != nil {
+		t.Fatalf("Client key pair: %v", err)
+	}
+
+	resp, err := tlsClient(ca, &clientCert).Get(url)
+	if err != nil {
+		t.Fatalf("Expected success with a client certificate: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+}
+
+// TestLoadTLSSettings tests that TLS is only enabled with both files set.
+func TestLoadTLSSettings(t *testing.T) {
+	t.Setenv("TLS_CERT_FILE", "/etc/tls/tls.crt")
+	t.Setenv("TLS_KEY_FILE", "")
+	t.Setenv("TLS_RELOAD_INTERVAL", "")
+
+	s, err := LoadTLSSettings()
+	if err != nil {
+		t.Fatalf("LoadTLSSettings: %v", err)
+	}
+	if s.Enabled() {
+		t.Error("Expected TLS to be disabled without a key file")
+	}
+	if s.ReloadInterval != 30*time.Second {
+		t.Errorf("Expected default reload interval 30s, got %v", s.ReloadInterval)
+	}
+
+	t.Setenv("TLS_KEY_FILE", "/etc/tls/tls.key")
+	t.Setenv("TLS_RELOAD_INTERVAL", "1m")
+
+	s, err = LoadTLSSettings()
+	if err != nil {
+		t.Fatalf("LoadTLSSettings: %v", err)
+	}
+	if !s.Enabled() {
+		t.Error("Expected TLS to be enabled")
+	}
+	if s.ReloadInterval != time.Minute {
+		t.Errorf("Expected reload interval 1m, got %v", s.ReloadInterval)
+	}
+}
+
+// TestLoadTLSSettingsRejectsBadInterval tests that an interval the reload
+// ticker cannot use fails at startup instead of panicking later.
+func TestLoadTLSSettingsRejectsBadInterval(t *testing.T) {
+	for _, v := range []string{"0s", "-1s", "soon"} {
+		t.Setenv("TLS_RELOAD_INTERVAL", v)
+		if _, err := LoadTLSSettings(); err == nil {
+			t.Errorf("TLS_RELOAD_INTERVAL=%q: expected an error", v)
+		}
+	}
+}
+
+// TestServerConfigErrors tests that bad settings are reported, not served.
+func TestServerConfigErrors(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := ca.writeKeyPair(t, dir, 2)
+
+	tests := []struct {
+		name     string
+		settings TLSSettings
+	}{
+		{"zero interval", TLSSettings{CertFile: certFile, KeyFile: keyFile}},
+		{"missing certificate", TLSSettings{CertFile: filepath.Join(dir, "missing.crt"), KeyFile: keyFile, ReloadInterval: time.Hour}},
+		{"missing client CA", TLSSettings{CertFile: certFile, KeyFile: keyFile, ClientCAFile: filepath.Join(dir, "missing-ca.crt"), ReloadInterval: time.Hour}},
+	}
+	for _, tt := range tests {
+		if _, err := tt.settings.ServerConfig(context.Background()); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
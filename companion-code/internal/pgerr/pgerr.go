@@ -0,0 +1,21 @@
+// Package pgerr classifies PostgreSQL errors from the lib/pq driver, so the
+// examples that talk to PostgreSQL turn them into the same domain errors.
+// PHP equivalent: Doctrine DBAL's exception hierarchy, e.g. UniqueConstraintViolationException
+package pgerr
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// uniqueViolation is the SQLSTATE for a unique constraint or index clash.
+const uniqueViolation = "23505"
+
+// IsUniqueViolation reports whether err, or any error it wraps, is
+// PostgreSQL's unique_violation.
+// PHP equivalent: catch (UniqueConstraintViolationException $e)
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
@@ -0,0 +1,28 @@
+package pgerr
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"unique violation", &pq.Error{Code: "23505"}, true},
+		{"wrapped", fmt.Errorf("insert user: %w", &pq.Error{Code: "23505"}), true},
+		{"foreign key violation", &pq.Error{Code: "23503"}, false},
+		{"other error", errors.New("connection refused"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsUniqueViolation(tt.err); got != tt.want {
+			t.Errorf("%s: IsUniqueViolation = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
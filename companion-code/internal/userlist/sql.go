@@ -0,0 +1,78 @@
+package userlist
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sortColumns maps sort fields to SQL. Text is compared bytewise
+// (COLLATE "C") so pages come out in the same order as from an in-memory
+// store sorted with strings.Compare, whatever the database's locale.
+var sortColumns = map[string]string{
+	"id":         "id",
+	"name":       `name COLLATE "C"`,
+	"email":      `email COLLATE "C"`,
+	"created_at": "created_at",
+}
+
+// SQL builds the keyset query for q, selecting columns from the users
+// table. It fetches one row more than the page size to learn whether there
+// is a next page. Only allow-listed column names are interpolated; every
+// value is a placeholder.
+// PHP equivalent: $qb->andWhere('(u.createdAt, u.id) > (:at, :id)')->setMaxResults($limit + 1)
+func (q Query) SQL(columns string) (string, []interface{}) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if q.NameContains != "" {
+		where = append(where, "name ILIKE "+arg("%"+escapeLike(q.NameContains)+"%"))
+	}
+	if q.EmailDomain != "" {
+		where = append(where, "email ILIKE "+arg("%@"+escapeLike(q.EmailDomain)))
+	}
+	if !q.CreatedAfter.IsZero() {
+		where = append(where, "created_at > "+arg(q.CreatedAfter))
+	}
+	if !q.CreatedBefore.IsZero() {
+		where = append(where, "created_at < "+arg(q.CreatedBefore))
+	}
+
+	column := sortColumns[q.Sort]
+	dir, op := "ASC", ">"
+	if q.Desc {
+		dir, op = "DESC", "<"
+	}
+
+	if q.After != nil {
+		// The cursor value was checked when it was decoded
+		var value interface{} = q.After.Value
+		switch q.Sort {
+		case "id":
+			value, _ = strconv.ParseInt(q.After.Value, 10, 64)
+		case "created_at":
+			value, _ = time.Parse(time.RFC3339Nano, q.After.Value)
+		}
+		// A row comparison is one index range scan on (column, id)
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)", column, op, arg(value), arg(q.After.ID)))
+	}
+
+	query := "SELECT " + columns + " FROM users"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s", column, dir, dir, arg(q.Limit+1))
+	return query, args
+}
+
+// escapeLike escapes LIKE wildcards so user input matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
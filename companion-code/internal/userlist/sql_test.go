@@ -0,0 +1,47 @@
+package userlist
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQuerySQL(t *testing.T) {
+	after := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		q     Query
+		query string
+		args  []interface{}
+	}{
+		{
+			"first page",
+			Query{Sort: "id", Limit: 20},
+			"SELECT id, name FROM users ORDER BY id ASC, id ASC LIMIT $1",
+			[]interface{}{21},
+		},
+		{
+			"filters escape wildcards",
+			Query{Sort: "name", Limit: 5, NameContains: "50%_off", EmailDomain: "example.com", CreatedAfter: after},
+			`SELECT id, name FROM users WHERE name ILIKE $1 AND email ILIKE $2 AND created_at > $3 ORDER BY name COLLATE "C" ASC, id ASC LIMIT $4`,
+			[]interface{}{`%50\%\_off%`, "%@example.com", after, 6},
+		},
+		{
+			"after a cursor, descending",
+			Query{Sort: "created_at", Desc: true, Limit: 10, After: &Cursor{Sort: "created_at", Desc: true, Value: after.Format(time.RFC3339Nano), ID: 7}},
+			"SELECT id, name FROM users WHERE (created_at, id) < ($1, $2) ORDER BY created_at DESC, id DESC LIMIT $3",
+			[]interface{}{after, int64(7), 11},
+		},
+	}
+
+	for _, tt := range tests {
+		query, args := tt.q.SQL("id, name")
+		if query != tt.query {
+			t.Errorf("%s: query = %s\nwant    %s", tt.name, query, tt.query)
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%s: args = %v, want %v", tt.name, args, tt.args)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Package userlist pages, sorts and filters user lists the same way in
+// every example that lists the users table: query parsing, opaque keyset
+// cursors, the Link header and the SQL.
+// PHP equivalent: a shared Doctrine repository trait plus API Platform's pagination
+package userlist
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dr-H-PhD/recompiling-your-mind-code/internal/httpx"
+)
+
+// Page sizes for list endpoints.
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// SortFields is the allow-list for the sort parameter.
+var SortFields = []string{"id", "name", "email", "created_at"}
+
+// Query selects one page of users. Pages are keyset-paginated: each page
+// starts after the (sort value, ID) of the last row of the previous one,
+// so rows inserted or deleted meanwhile never shift a page.
+// PHP equivalent: a Doctrine QueryBuilder with setMaxResults() and a WHERE on the last seen key
+type Query struct {
+	Sort  string // One of SortFields
+	Desc  bool
+	Limit int
+	After *Cursor // Nil for the first page
+
+	NameContains  string    // Case-insensitive substring of the name
+	EmailDomain   string    // Case-insensitive domain, e.g. "example.com"
+	CreatedAfter  time.Time // Exclusive; zero for no bound
+	CreatedBefore time.Time // Exclusive; zero for no bound
+}
+
+// Cursor is the position after which the next page starts. Clients see it
+// only as an opaque string. It records the sort it was made for, since the
+// position means nothing under another order.
+type Cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"` // The sort field of the last row, as text
+	ID    int64  `json:"i"` // Tie-breaker for equal sort values
+}
+
+// Encode returns the cursor as an opaque, URL-safe string.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// CursorAfter returns the cursor positioned after the user with these
+// fields, the last row of a page.
+func (q Query) CursorAfter(id int64, name, email string, createdAt time.Time) *Cursor {
+	c := &Cursor{Sort: q.Sort, Desc: q.Desc, ID: id}
+	switch q.Sort {
+	case "id":
+		c.Value = strconv.FormatInt(id, 10)
+	case "name":
+		c.Value = name
+	case "email":
+		c.Value = email
+	case "created_at":
+		c.Value = createdAt.Format(time.RFC3339Nano)
+	}
+	return c
+}
+
+// Parse reads the list parameters, returning {parameter: message} for any
+// that are invalid:
+//
+//	limit           page size, 1 to MaxPageSize
+//	cursor          from the previous page's Link header
+//	sort, order     one of SortFields; asc or desc
+//	name            name contains, case-insensitive
+//	email_domain    email domain, case-insensitive
+//	created_after   RFC 3339 time, exclusive
+//	created_before  RFC 3339 time, exclusive
+func Parse(r *http.Request, defaultSort string, defaultDesc bool) (Query, map[string]string) {
+	params := r.URL.Query()
+	errs := make(map[string]string)
+	q := Query{
+		Sort:         defaultSort,
+		Desc:         defaultDesc,
+		Limit:        DefaultPageSize,
+		NameContains: strings.TrimSpace(params.Get("name")),
+		EmailDomain:  strings.TrimPrefix(strings.TrimSpace(params.Get("email_domain")), "@"),
+	}
+
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxPageSize {
+			errs["limit"] = fmt.Sprintf("Limit must be a number from 1 to %d", MaxPageSize)
+		}
+		q.Limit = n
+	}
+
+	if v := params.Get("sort"); v != "" {
+		if !slices.Contains(SortFields, v) {
+			errs["sort"] = "Sort must be one of: " + strings.Join(SortFields, ", ")
+		}
+		q.Sort = v
+	}
+
+	switch params.Get("order") {
+	case "":
+	case "asc":
+		q.Desc = false
+	case "desc":
+		q.Desc = true
+	default:
+		errs["order"] = "Order must be asc or desc"
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"created_after", &q.CreatedAfter}, {"created_before", &q.CreatedBefore}} {
+		if v := params.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				errs[p.name] = "Must be an RFC 3339 time, e.g. 2024-01-31T00:00:00Z"
+			}
+			*p.dst = t
+		}
+	}
+
+	if v := params.Get("cursor"); v != "" {
+		c, err := decodeCursor(v)
+		switch {
+		case err != nil:
+			errs["cursor"] = "Invalid cursor"
+		case c.Sort != q.Sort || c.Desc != q.Desc:
+			errs["cursor"] = "Cursor was issued for a different sort order"
+		}
+		q.After = c
+	}
+
+	return q, errs
+}
+
+// decodeCursor parses a cursor and checks its value suits its sort field.
+func decodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+
+	switch c.Sort {
+	case "id":
+		_, err = strconv.ParseInt(c.Value, 10, 64)
+	case "created_at":
+		_, err = time.Parse(time.RFC3339Nano, c.Value)
+	case "name", "email":
+	default:
+		err = fmt.Errorf("unknown sort field %q", c.Sort)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// WriteQueryError renders invalid list parameters as a 400.
+func WriteQueryError(w http.ResponseWriter, r *http.Request, errs map[string]string) {
+	problem := httpx.NewProblem(w, r, http.StatusBadRequest, "INVALID_QUERY", "Invalid query parameters")
+	problem.Extensions["errors"] = errs
+	httpx.Render(w, r, http.StatusBadRequest, problem)
+}
+
+// SetPageLinks sets the Link header (RFC 8288) with the first page and, if
+// there is one, the next. Other query parameters are kept as they are.
+// PHP equivalent: the hydra:view links API Platform adds to collections
+func SetPageLinks(w http.ResponseWriter, r *http.Request, next *Cursor) {
+	link := func(cursor string, rel string) string {
+		params := r.URL.Query()
+		params.Del("cursor")
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+		u := url.URL{Path: r.URL.Path, RawQuery: params.Encode()}
+		return fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel)
+	}
+
+	links := []string{link("", "first")}
+	if next != nil {
+		links = append(links, link(next.Encode(), "next"))
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
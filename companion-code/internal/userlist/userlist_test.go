@@ -0,0 +1,57 @@
+package userlist
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	nameCursor := Cursor{Sort: "name", Value: "Bob", ID: 3}.Encode()
+
+	tests := []struct {
+		query string
+		field string // Expected error, or "" for none
+	}{
+		{"", ""},
+		{"limit=100&sort=created_at&order=desc&name=bo&email_domain=example.com&created_after=2024-01-01T00:00:00Z", ""},
+		{"sort=name&cursor=" + nameCursor, ""},
+		{"limit=0", "limit"},
+		{"limit=101", "limit"},
+		{"sort=password", "sort"},
+		{"order=up", "order"},
+		{"created_before=yesterday", "created_before"},
+		{"cursor=not-a-cursor", "cursor"},
+		{"cursor=" + nameCursor, "cursor"}, // Issued for sort=name
+		{"sort=id&cursor=" + Cursor{Sort: "id", Value: "abc"}.Encode(), "cursor"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/users?"+tt.query, nil)
+		_, errs := Parse(r, "id", false)
+		switch {
+		case tt.field == "" && len(errs) > 0:
+			t.Errorf("%q: unexpected errors %v", tt.query, errs)
+		case tt.field != "" && errs[tt.field] == "":
+			t.Errorf("%q: expected an error for %s, got %v", tt.query, tt.field, errs)
+		}
+	}
+}
+
+func TestSetPageLinks(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/users?limit=2&cursor=old&sort=name", nil)
+	next := &Cursor{Sort: "name", Value: "Bob", ID: 3}
+
+	rec := httptest.NewRecorder()
+	SetPageLinks(rec, r, next)
+	want := `</users?limit=2&sort=name>; rel="first", </users?cursor=` + next.Encode() + `&limit=2&sort=name>; rel="next"`
+	if got := rec.Header().Get("Link"); got != want {
+		t.Errorf("Link = %s\nwant   %s", got, want)
+	}
+
+	rec = httptest.NewRecorder()
+	SetPageLinks(rec, r, nil)
+	if got := rec.Header().Get("Link"); got != `</users?limit=2&sort=name>; rel="first"` {
+		t.Errorf("last page: Link = %s", got)
+	}
+}